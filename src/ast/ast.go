@@ -9,6 +9,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first byte of the node
+	End() token.Position // position immediately after the node
 }
 
 type Statement interface {
@@ -32,6 +34,18 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
 func (p *Program) String() string {
 	var buf bytes.Buffer
 
@@ -48,10 +62,24 @@ type LetStatement struct {
 	Value Expression
 }
 
+// IsConst reports whether the statement declares a constant binding.
+func (l *LetStatement) IsConst() bool {
+	return l.Token.Type == token.CONST
+}
+
 func (l *LetStatement) TokenLiteral() string {
 	return l.Token.Literal
 }
 func (l *LetStatement) statementNode() {}
+func (l *LetStatement) Pos() token.Position {
+	return l.Token.Pos
+}
+func (l *LetStatement) End() token.Position {
+	if l.Value != nil {
+		return l.Value.End()
+	}
+	return l.Name.End()
+}
 func (l *LetStatement) String() string {
 	var buf bytes.Buffer
 
@@ -70,12 +98,39 @@ func (l *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Binding is filled in by the resolver before the program runs.
+	Binding Binding
+}
+
+// BindingKind tells what an identifier refers to.
+type BindingKind int
+
+const (
+	Unresolved BindingKind = iota
+	Variable
+	Builtin
+)
+
+// Binding locates what an identifier refers to. A variable lives in slot
+// Slot of the environment Depth functions out from the one the
+// identifier is used in; for a builtin, Slot is its index in the list of
+// builtins.
+type Binding struct {
+	Kind  BindingKind
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 func (i *Identifier) expressionNode() {}
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -89,10 +144,35 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
 func (il *IntegerLiteral) String() string {
 	return il.TokenLiteral()
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
+func (fl *FloatLiteral) String() string {
+	return fl.TokenLiteral()
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -102,6 +182,15 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 func (rs *ReturnStatement) String() string {
 	var buf bytes.Buffer
 
@@ -114,6 +203,28 @@ func (rs *ReturnStatement) String() string {
 	return buf.String()
 }
 
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *ThrowStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+func (ts *ThrowStatement) End() token.Position {
+	if ts.Value != nil {
+		return ts.Value.End()
+	}
+	return ts.Token.End
+}
+func (ts *ThrowStatement) String() string {
+	return ts.Token.Literal + " " + ts.Value.String() + ";"
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -123,6 +234,15 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 func (es *ExpressionStatement) statementNode() {}
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 func (es *ExpressionStatement) String() string {
 	return es.Expression.String()
 }
@@ -137,6 +257,15 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 func (pe *PrefixExpression) expressionNode() {}
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
 	var buf bytes.Buffer
 
@@ -159,6 +288,15 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 func (ie *InfixExpression) expressionNode() {}
+func (ie *InfixExpression) Pos() token.Position {
+	return ie.Left.Pos()
+}
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
 func (ie *InfixExpression) String() string {
 	var buf bytes.Buffer
 
@@ -171,6 +309,38 @@ func (ie *InfixExpression) String() string {
 	return buf.String()
 }
 
+// AssignExpression assigns to an existing variable or to an element of an
+// array or hash. Operator is "=" or a compound operator such as "+=".
+type AssignExpression struct {
+	Token    token.Token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Target.Pos()
+}
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return ae.Value.End()
+	}
+	return ae.Token.End
+}
+func (ae *AssignExpression) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(ae.Target.String())
+	buf.WriteString(" " + ae.Operator + " ")
+	buf.WriteString(ae.Value.String())
+
+	return buf.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -180,6 +350,12 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
 func (b *Boolean) String() string {
 	return b.TokenLiteral()
 }
@@ -195,6 +371,15 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
 func (ie *IfExpression) String() string {
 	var buf bytes.Buffer
 
@@ -210,15 +395,65 @@ func (ie *IfExpression) String() string {
 	return buf.String()
 }
 
-type BlockStatement struct {
+// TryExpression runs Block, handing an error raised by it to Catch with
+// the error bound to CatchParam. Finally, if present, runs last in any
+// case. At least one of Catch and Finally is set.
+type TryExpression struct {
 	Token      token.Token
+	Block      *BlockStatement
+	CatchParam *Identifier
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+func (te *TryExpression) End() token.Position {
+	switch {
+	case te.Finally != nil:
+		return te.Finally.End()
+	case te.Catch != nil:
+		return te.Catch.End()
+	}
+	return te.Block.End()
+}
+func (te *TryExpression) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("try ")
+	buf.WriteString(te.Block.String())
+	if te.Catch != nil {
+		buf.WriteString(" catch (" + te.CatchParam.String() + ") ")
+		buf.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		buf.WriteString(" finally ")
+		buf.WriteString(te.Finally.String())
+	}
+	return buf.String()
+}
+
+type BlockStatement struct {
+	Token      token.Token // the '{' token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+func (bs *BlockStatement) End() token.Position {
+	return bs.Rbrace.End
+}
 func (bs *BlockStatement) String() string {
 	var buf bytes.Buffer
 	for _, s := range bs.Statements {
@@ -230,19 +465,35 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Defaults   []Expression // parallel to Parameters, nil for required ones
+	Rest       *Identifier  // collects the remaining arguments, may be nil
 	Body       *BlockStatement
+	Name       string // set when the literal is bound with let
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+func (fl *FunctionLiteral) End() token.Position {
+	return fl.Body.End()
+}
 func (fl *FunctionLiteral) String() string {
 	var buf bytes.Buffer
 
 	params := make([]string, 0)
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+fl.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 
 	buf.WriteString(fl.TokenLiteral())
@@ -255,15 +506,22 @@ func (fl *FunctionLiteral) String() string {
 }
 
 type CallExpression struct {
-	Token     token.Token
+	Token     token.Token // the '(' token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token
 }
 
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 func (ce *CallExpression) expressionNode() {}
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Function.Pos()
+}
+func (ce *CallExpression) End() token.Position {
+	return ce.Rparen.End
+}
 func (ce *CallExpression) String() string {
 	var buf bytes.Buffer
 
@@ -288,19 +546,32 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+func (sl *StringLiteral) End() token.Position {
+	return sl.Token.End
+}
 func (sl *StringLiteral) String() string {
 	return sl.TokenLiteral()
 }
 
 type ArrayLiteral struct {
-	Token    token.Token
+	Token    token.Token // the '[' token
 	Elements []Expression
+	Rbracket token.Token
 }
 
 func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+func (al *ArrayLiteral) End() token.Position {
+	return al.Rbracket.End
+}
 func (al *ArrayLiteral) String() string {
 	var buf bytes.Buffer
 
@@ -316,15 +587,22 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token // the '[' token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
 }
 
 func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IndexExpression) Pos() token.Position {
+	return ie.Left.Pos()
+}
+func (ie *IndexExpression) End() token.Position {
+	return ie.Rbracket.End
+}
 func (ie *IndexExpression) String() string {
 	var buf bytes.Buffer
 
@@ -338,20 +616,27 @@ func (ie *IndexExpression) String() string {
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token // the '{' token
+	Pairs  []*HashPair // in source order
+	Rbrace token.Token
 }
 
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+func (hl *HashLiteral) End() token.Position {
+	return hl.Rbrace.End
+}
 func (hl *HashLiteral) String() string {
 	var buf bytes.Buffer
 
 	pairs := []string{}
-	for k, v := range hl.Pairs {
-		pairs = append(pairs, k.String()+":"+v.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.String())
 	}
 
 	buf.WriteString("{")
@@ -360,3 +645,249 @@ func (hl *HashLiteral) String() string {
 
 	return buf.String()
 }
+
+// HashPair is a key: value entry of a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hp *HashPair) TokenLiteral() string {
+	return hp.Key.TokenLiteral()
+}
+func (hp *HashPair) Pos() token.Position {
+	return hp.Key.Pos()
+}
+func (hp *HashPair) End() token.Position {
+	return hp.Value.End()
+}
+func (hp *HashPair) String() string {
+	return hp.Key.String() + ":" + hp.Value.String()
+}
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+func (ws *WhileStatement) End() token.Position {
+	return ws.Body.End()
+}
+func (ws *WhileStatement) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("while")
+	buf.WriteString(ws.Condition.String())
+	buf.WriteString(" ")
+	buf.WriteString(ws.Body.String())
+
+	return buf.String()
+}
+
+// ForStatement iterates over an array, hash or string. Key is nil unless
+// two loop variables are given, as in for (k, v in hash) { ... }.
+type ForStatement struct {
+	Token    token.Token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+func (fs *ForStatement) End() token.Position {
+	return fs.Body.End()
+}
+func (fs *ForStatement) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("for (")
+	if fs.Key != nil {
+		buf.WriteString(fs.Key.String() + ", ")
+	}
+	buf.WriteString(fs.Value.String())
+	buf.WriteString(" in ")
+	buf.WriteString(fs.Iterable.String())
+	buf.WriteString(") ")
+	buf.WriteString(fs.Body.String())
+
+	return buf.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+func (bs *BreakStatement) End() token.Position {
+	return bs.Token.End
+}
+func (bs *BreakStatement) String() string {
+	return bs.Token.Literal + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+func (cs *ContinueStatement) End() token.Position {
+	return cs.Token.End
+}
+func (cs *ContinueStatement) String() string {
+	return cs.Token.Literal + ";"
+}
+
+// ImportStatement binds the module in the file at Path. The module is
+// bound as a whole to Name, or, when Members is set, its exports are
+// bound to variables of their own, as in import { a, b as c } from "lib.mk".
+type ImportStatement struct {
+	Token   token.Token // the 'import' token
+	Path    *StringLiteral
+	Name    *Identifier
+	Members []*ImportMember
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *ImportStatement) Pos() token.Position {
+	return is.Token.Pos
+}
+func (is *ImportStatement) End() token.Position {
+	if is.Name != nil {
+		return is.Name.End()
+	}
+	return is.Path.End()
+}
+func (is *ImportStatement) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("import ")
+	if is.Name != nil {
+		buf.WriteString("\"" + is.Path.String() + "\" as " + is.Name.String())
+	} else {
+		members := []string{}
+		for _, m := range is.Members {
+			members = append(members, m.String())
+		}
+		buf.WriteString("{ " + strings.Join(members, ", ") + " }")
+		buf.WriteString(" from \"" + is.Path.String() + "\"")
+	}
+	buf.WriteString(";")
+
+	return buf.String()
+}
+
+// ImportMember binds the export Export of a module to the variable Name,
+// which has the name of the export unless it is renamed with as.
+type ImportMember struct {
+	Export *Identifier
+	Name   *Identifier
+}
+
+func (im *ImportMember) TokenLiteral() string {
+	return im.Export.TokenLiteral()
+}
+func (im *ImportMember) Pos() token.Position {
+	return im.Export.Pos()
+}
+func (im *ImportMember) End() token.Position {
+	return im.Name.End()
+}
+func (im *ImportMember) String() string {
+	if im.Name.Value == im.Export.Value {
+		return im.Name.String()
+	}
+	return im.Export.String() + " as " + im.Name.String()
+}
+
+// ExportStatement declares a variable of a module that files importing
+// the module can use.
+type ExportStatement struct {
+	Token     token.Token // the 'export' token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+func (es *ExportStatement) TokenLiteral() string {
+	return es.Token.Literal
+}
+func (es *ExportStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+func (es *ExportStatement) End() token.Position {
+	return es.Statement.End()
+}
+func (es *ExportStatement) String() string {
+	return "export " + es.Statement.String()
+}
+
+// BadStatement is a placeholder for a statement that could not be parsed.
+// It spans from Token up to To.
+type BadStatement struct {
+	Token token.Token
+	To    token.Position
+}
+
+func (bs *BadStatement) statementNode() {}
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BadStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+func (bs *BadStatement) End() token.Position {
+	return bs.To
+}
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+// BadExpression is a placeholder for an expression that could not be parsed.
+// It spans from Token up to To.
+type BadExpression struct {
+	Token token.Token
+	To    token.Position
+}
+
+func (be *BadExpression) expressionNode() {}
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+func (be *BadExpression) Pos() token.Position {
+	return be.Token.Pos
+}
+func (be *BadExpression) End() token.Position {
+	return be.To
+}
+func (be *BadExpression) String() string {
+	return "<bad expression>"
+}
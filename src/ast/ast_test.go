@@ -1,7 +1,9 @@
 package ast
 
 import (
+	"bytes"
 	"playground/go-interpreter/src/token"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +36,93 @@ func TestString(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestFprint(t *testing.T) {
+	p := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Token: token.Token{Type: token.MINUS, Literal: "-"},
+				Expression: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-"},
+					Operator: "-",
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5"},
+						Value: 5,
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, p); err != nil {
+		t.Fatalf("Fprint returned error: %s", err)
+	}
+
+	expected := `Program
+  Statements[0]: ExpressionStatement
+    Expression: PrefixExpression Operator="-"
+      Right: IntegerLiteral Value=5
+`
+	if buf.String() != expected {
+		t.Errorf("wrong tree. expected=\n%s\ngot=\n%s", expected, buf.String())
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	// let f = fn(a) { a + b }; f(c)
+	p := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("a")},
+					Defaults:   []Expression{nil},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{
+								Expression: &InfixExpression{
+									Left:     ident("a"),
+									Operator: "+",
+									Right:    ident("b"),
+								},
+							},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Expression: &CallExpression{
+					Function:  ident("f"),
+					Arguments: []Expression{ident("c")},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		skipFunctions bool
+		expected      string
+	}{
+		{false, "f a a b f c"},
+		{true, "f f c"},
+	}
+
+	for _, tt := range tests {
+		var names []string
+		Inspect(p, func(node Node) bool {
+			if ident, ok := node.(*Identifier); ok {
+				names = append(names, ident.Value)
+			}
+			_, isFunction := node.(*FunctionLiteral)
+			return !(tt.skipFunctions && isFunction)
+		})
+		if got := strings.Join(names, " "); got != tt.expected {
+			t.Errorf("wrong identifiers visited. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// Fprint writes an indented tree representation of node to w, one node
+// per line with its scalar fields and source range.
+func Fprint(w io.Writer, node Node) error {
+	p := &printer{w: w}
+	p.print(reflect.ValueOf(node), "", 0)
+	return p.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(indent int, format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, strings.Repeat("  ", indent)+format+"\n", args...)
+}
+
+func (p *printer) print(v reflect.Value, label string, indent int) {
+	if label != "" {
+		label += ": "
+	}
+
+	if !v.IsValid() || (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		p.printf(indent, "%snil", label)
+		return
+	}
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	node := v.Interface().(Node)
+	s := v.Elem()
+	t := s.Type()
+
+	var attrs []string
+	for i := 0; i < t.NumField(); i++ {
+		f := s.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			if f.Len() > 0 {
+				attrs = append(attrs, fmt.Sprintf("%s=%q", t.Field(i).Name, f.String()))
+			}
+		case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+			attrs = append(attrs, fmt.Sprintf("%s=%#v", t.Field(i).Name, f.Interface()))
+		}
+	}
+
+	header := label + t.Name()
+	if len(attrs) > 0 {
+		header += " " + strings.Join(attrs, " ")
+	}
+	if pos := node.Pos(); pos.IsValid() {
+		end := node.End()
+		header += fmt.Sprintf(" [%d:%d-%d:%d]", pos.Line, pos.Column, end.Line, end.Column)
+	}
+	p.printf(indent, "%s", header)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := s.Field(i)
+		name := t.Field(i).Name
+
+		switch {
+		case f.Type().Implements(nodeType):
+			p.print(f, name, indent+1)
+
+		case f.Kind() == reflect.Slice && f.Type().Elem().Implements(nodeType):
+			for j := 0; j < f.Len(); j++ {
+				p.print(f.Index(j), fmt.Sprintf("%s[%d]", name, j), indent+1)
+			}
+		}
+	}
+}
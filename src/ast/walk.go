@@ -0,0 +1,112 @@
+package ast
+
+// Inspect traverses the tree rooted at node in source order, calling f
+// for each node. When f returns false, the children of that node are
+// skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *LetStatement:
+		Inspect(node.Name, f)
+		inspectExpression(node.Value, f)
+	case *ExportStatement:
+		Inspect(node.Statement, f)
+	case *ImportStatement:
+		Inspect(node.Path, f)
+		if node.Name != nil {
+			Inspect(node.Name, f)
+		}
+		for _, m := range node.Members {
+			Inspect(m, f)
+		}
+	case *ImportMember:
+		// The export is a name in the module, not a variable.
+		Inspect(node.Name, f)
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+	case *ThrowStatement:
+		inspectExpression(node.Value, f)
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+	case *WhileStatement:
+		inspectExpression(node.Condition, f)
+		Inspect(node.Body, f)
+	case *ForStatement:
+		if node.Key != nil {
+			Inspect(node.Key, f)
+		}
+		Inspect(node.Value, f)
+		inspectExpression(node.Iterable, f)
+		Inspect(node.Body, f)
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+	case *AssignExpression:
+		inspectExpression(node.Target, f)
+		inspectExpression(node.Value, f)
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		Inspect(node.Consequence, f)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, f)
+		}
+	case *TryExpression:
+		Inspect(node.Block, f)
+		if node.Catch != nil {
+			Inspect(node.CatchParam, f)
+			Inspect(node.Catch, f)
+		}
+		if node.Finally != nil {
+			Inspect(node.Finally, f)
+		}
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			Inspect(param, f)
+			if i < len(node.Defaults) {
+				inspectExpression(node.Defaults[i], f)
+			}
+		}
+		if node.Rest != nil {
+			Inspect(node.Rest, f)
+		}
+		Inspect(node.Body, f)
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		for _, arg := range node.Arguments {
+			inspectExpression(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			inspectExpression(el, f)
+		}
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			inspectExpression(pair.Key, f)
+			inspectExpression(pair.Value, f)
+		}
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+	}
+}
+
+// inspectExpression inspects expr unless it is missing, as the value of
+// a bare return statement or a parameter without a default is.
+func inspectExpression(expr Expression, f func(Node) bool) {
+	if expr != nil {
+		Inspect(expr, f)
+	}
+}
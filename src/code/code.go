@@ -0,0 +1,294 @@
+// Package code defines the bytecode the compiler produces and the virtual
+// machine executes.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"playground/go-interpreter/src/token"
+	"sort"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	// OpDup pushes the value on top of the stack again, OpDup2 the two
+	// values on top.
+	OpDup
+	OpDup2
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+	// OpJumpIfSet jumps if the local given by its first operand holds a
+	// value, which for a parameter means an argument was passed for it.
+	OpJumpIfSet
+
+	OpGetGlobal
+	// OpSetGlobal declares a global, OpAssignGlobal assigns to one that
+	// has to be declared already.
+	OpSetGlobal
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpSetFree
+	// OpCaptureLocal and OpCaptureFree push the variable itself rather
+	// than its value, for OpClosure to share it with the new closure.
+	OpCaptureLocal
+	OpCaptureFree
+	OpClosure
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+
+	OpCall
+	// OpTailCall is a call whose result is returned right away. A call to
+	// a Monkey function replaces the frame of the caller.
+	OpTailCall
+	OpReturnValue
+	OpReturn
+
+	// OpIter replaces the value on top of the stack with an iterator over
+	// it. OpIterNext pushes the next key and value, or jumps when the
+	// iterator is exhausted.
+	OpIter
+	OpIterNext
+
+	OpThrow
+	// OpError raises a runtime error whose message is the constant given
+	// by its operand, for code the compiler knows to fail when it runs.
+	OpError
+	// OpTry installs a handler: an error raised before the matching
+	// OpEndTry resumes execution at the operand with the error on the
+	// stack. OpCaught turns that error into the value a catch block sees.
+	OpTry
+	OpEndTry
+	OpCaught
+
+	// OpImport pushes the module whose path is the constant given by its
+	// operand.
+	OpImport
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpDup2:     {"OpDup2", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpIfSet:     {"OpJumpIfSet", []int{1, 2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{1}},
+	OpSetLocal:     {"OpSetLocal", []int{1}},
+	OpGetBuiltin:   {"OpGetBuiltin", []int{1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+	OpClosure:      {"OpClosure", []int{2, 1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpIter:     {"OpIter", []int{1}},
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	OpThrow:  {"OpThrow", []int{}},
+	OpError:  {"OpError", []int{2}},
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpCaught: {"OpCaught", []int{}},
+
+	OpImport: {"OpImport", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// SourcePos records that the instructions from Offset on were compiled
+// from the source at Pos.
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+}
+
+// SourceMap maps instruction offsets back to the source, for error
+// messages. Its entries are sorted by offset.
+type SourceMap []SourcePos
+
+// Lookup returns the source position of the instruction at offset.
+func (m SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return m[i-1].Pos
+}
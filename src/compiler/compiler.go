@@ -0,0 +1,1114 @@
+// Package compiler translates a parsed Monkey program into bytecode for
+// the virtual machine in package vm.
+package compiler
+
+import (
+	"fmt"
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/code"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/token"
+	"strings"
+)
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	strict bool
+	// incremental leaves the globals that functions use without the
+	// program declaring them for later programs to declare.
+	incremental bool
+	// overflow is the first operand too large for its instruction, which
+	// is reported once the program is compiled.
+	overflow error
+	// forwards are the identifiers in functions taken to be globals
+	// declared later, which the program must declare by its end.
+	forwards []forward
+	// pos is the position of the node being compiled, recorded for the
+	// instructions emitted for it.
+	pos token.Position
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.SourceMap
+
+	// loops are the loops enclosing the code being compiled, innermost
+	// last.
+	loops []*loop
+	// tries holds the finally blocks of the try blocks enclosing the code
+	// being compiled, innermost last, with nil for those without one.
+	tries []*ast.BlockStatement
+}
+
+// loop collects the jumps of break and continue statements.
+type loop struct {
+	continueTarget int
+	breaks         []int
+	// tries is the number of enclosing try blocks when the loop starts.
+	tries int
+}
+
+// forward is an identifier in a function that refers to no variable
+// declared before it.
+type forward struct {
+	name   string
+	pos    token.Position
+	format string
+}
+
+// Error is a problem with a program found while compiling it, such as an
+// assignment to a constant.
+type Error struct {
+	Message string
+	Pos     token.Position
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{}
+
+	symbolTable := NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState creates a compiler that adds to the globals and constants
+// of earlier compilations, as the REPL does for every line.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SetStrict makes declaring a name twice in the same scope an error.
+func (c *Compiler) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// SetIncremental makes the program one of a session whose later programs
+// can declare the globals its functions use, as the inputs of the REPL
+// are. Using such a global before it is declared is a runtime error.
+func (c *Compiler) SetIncremental(incremental bool) {
+	c.incremental = incremental
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	defer c.at(node)()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := c.compileProgram(node); err != nil {
+			return err
+		}
+		if c.overflow != nil {
+			return c.overflow
+		}
+		return c.checkForwards()
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		return c.compileBlock(node.Statements, false)
+
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+
+	case *ast.ExportStatement:
+		return c.compileLetStatement(node.Statement)
+
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+
+	case *ast.ReturnStatement:
+		return c.compileReturnStatement(node)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.errorf("break outside loop")
+		}
+		if err := c.leaveTries(loop.tries); err != nil {
+			return err
+		}
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.errorf("continue outside loop")
+		}
+		if err := c.leaveTries(loop.tries); err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.continueTarget)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node, false)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.Identifier:
+		symbol, err := c.resolve(node.Value, "identifier not found: %s")
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		return c.compileCallExpression(node, false)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.BadExpression:
+		// Only reached for programs with syntax errors; like the
+		// evaluator, carry on with no value.
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+}
+
+// at makes node the source of the instructions emitted until the
+// returned function restores the previous one.
+func (c *Compiler) at(node ast.Node) func() {
+	prev := c.pos
+	c.pos = node.Pos()
+	return func() { c.pos = prev }
+}
+
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, a...), Pos: c.pos}
+}
+
+// compileProgram compiles the statements of program so that they return
+// the value of the last one: nothing for a declaration, null for other
+// statements without a value.
+func (c *Compiler) compileProgram(program *ast.Program) error {
+	stmts := program.Statements
+	if len(stmts) > 0 {
+		switch stmts[len(stmts)-1].(type) {
+		case *ast.LetStatement, *ast.ExportStatement, *ast.ImportStatement:
+			if err := c.compileStatements(stmts); err != nil {
+				return err
+			}
+			c.emit(code.OpReturn)
+			return nil
+		}
+	}
+
+	if err := c.compileBlock(stmts, false); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	for _, s := range stmts {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBlock compiles stmts so that they leave their value on the
+// stack: the value of the last statement if it is an expression, null
+// otherwise. When the block is in tail position, so is its last
+// expression.
+func (c *Compiler) compileBlock(stmts []ast.Statement, tail bool) error {
+	for i, s := range stmts {
+		if es, ok := s.(*ast.ExpressionStatement); ok && i == len(stmts)-1 {
+			if tail {
+				return c.compileTail(es.Expression)
+			}
+			return c.Compile(es.Expression)
+		}
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+// compileTail compiles an expression whose value the function returns.
+// Calls made there replace the frame of the function.
+func (c *Compiler) compileTail(node ast.Expression) error {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		defer c.at(node)()
+		return c.compileCallExpression(node, true)
+	case *ast.IfExpression:
+		defer c.at(node)()
+		return c.compileIfExpression(node, true)
+	default:
+		return c.Compile(node)
+	}
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	name := node.Name.Value
+	if msg := c.declarationError(name); msg != "" {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.raise("%s", msg)
+		return nil
+	}
+
+	define := c.symbolTable.Define
+	if node.IsConst() {
+		define = c.symbolTable.DefineConst
+	}
+
+	// A function can refer to itself by the name it is bound to. Other
+	// values are compiled before the name is declared, so that they still
+	// see an outer variable of the same name.
+	var symbol Symbol
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		symbol = define(name)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+	} else {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol = define(name)
+	}
+
+	c.storeSymbol(symbol)
+	return nil
+}
+
+// compileImportStatement binds the module of node, or each of the
+// exports it names, like a let statement.
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) error {
+	path := c.addConstant(&object.String{Value: node.Path.Value})
+	c.emit(code.OpImport, path)
+
+	if node.Name != nil {
+		if msg := c.declarationError(node.Name.Value); msg != "" {
+			c.raise("%s", msg)
+			return nil
+		}
+		c.storeSymbol(c.symbolTable.Define(node.Name.Value))
+		return nil
+	}
+
+	for _, m := range node.Members {
+		if err := c.compileImportMember(m); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+// compileImportMember binds an export of the module on top of the stack,
+// leaving the module there.
+func (c *Compiler) compileImportMember(m *ast.ImportMember) error {
+	defer c.at(m)()
+
+	if msg := c.declarationError(m.Name.Value); msg != "" {
+		c.raise("%s", msg)
+		return nil
+	}
+	c.emit(code.OpDup)
+	c.emit(code.OpConstant, c.addConstant(&object.String{Value: m.Export.Value}))
+	c.emit(code.OpIndex)
+	c.storeSymbol(c.symbolTable.Define(m.Name.Value))
+	return nil
+}
+
+// declarationError returns the message of the error declaring name in
+// the current scope raises, or "" if it may be declared: constants can
+// never be redeclared in their scope, and in strict mode no name can.
+func (c *Compiler) declarationError(name string) string {
+	symbol, ok := c.symbolTable.Declared(name)
+	if !ok {
+		return ""
+	}
+	if symbol.Const {
+		return fmt.Sprintf("cannot redeclare constant: %s", name)
+	}
+	if c.strict {
+		return fmt.Sprintf("identifier already declared: %s", name)
+	}
+	return ""
+}
+
+// defineVariable declares a variable set by a loop or a catch clause. A
+// constant cannot be set that way, so for one it emits the error setting
+// it raises and returns the constant.
+func (c *Compiler) defineVariable(name string) Symbol {
+	if symbol, ok := c.symbolTable.Declared(name); ok && symbol.Const {
+		c.raise("cannot assign to constant: %s", name)
+		return symbol
+	}
+	return c.symbolTable.Define(name)
+}
+
+// source returns fn as the evaluator shows it, so that functions look
+// the same on both engines.
+func (c *Compiler) source(fn *ast.FunctionLiteral) string {
+	f := &object.Function{Parameters: fn.Parameters, Defaults: fn.Defaults, Rest: fn.Rest, Body: fn.Body}
+	return f.Inspect()
+}
+
+// raise emits an instruction raising a runtime error. Like the evaluator,
+// the compiler reports errors such as assigning to a constant only when
+// the code runs, which it may never do.
+func (c *Compiler) raise(format string, a ...interface{}) {
+	msg := &object.String{Value: fmt.Sprintf(format, a...)}
+	c.emit(code.OpError, c.addConstant(msg))
+}
+
+func (c *Compiler) compileReturnStatement(node *ast.ReturnStatement) error {
+	// Returning from inside a try block runs its finally block first, so
+	// the call cannot replace the frame.
+	if c.scopeIndex > 0 && len(c.scopes[c.scopeIndex].tries) == 0 {
+		if err := c.compileTail(node.ReturnValue); err != nil {
+			return err
+		}
+	} else if err := c.Compile(node.ReturnValue); err != nil {
+		return err
+	}
+
+	if err := c.leaveTries(0); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression, tail bool) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Emit an `OpJumpNotTruthy` with a bogus value
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlock(node.Consequence.Statements, tail); err != nil {
+		return err
+	}
+
+	// Emit an `OpJump` with a bogus value
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	afterConsequencePos := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		if err := c.compileBlock(node.Alternative.Statements, tail); err != nil {
+			return err
+		}
+	}
+
+	afterAlternativePos := len(c.currentInstructions())
+	c.changeOperand(jumpPos, afterAlternativePos)
+
+	return nil
+}
+
+// compileLogicalExpression compiles && and ||, which only evaluate their
+// right operand when the left one does not decide the result.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	var jumpPos int
+	if node.Operator == "&&" {
+		if err := c.compileBoolean(node.Right); err != nil {
+			return err
+		}
+		jumpPos = c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+	} else {
+		c.emit(code.OpTrue)
+		jumpPos = c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		if err := c.compileBoolean(node.Right); err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBoolean compiles node to leave true or false on the stack,
+// depending on whether its value is truthy.
+func (c *Compiler) compileBoolean(node ast.Expression) error {
+	if err := c.Compile(node); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	startPos := len(c.currentInstructions())
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	c.enterLoop(startPos)
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, startPos)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.changeOperand(exitPos, afterLoopPos)
+	c.leaveLoop(afterLoopPos)
+
+	return nil
+}
+
+// compileForStatement compiles a for loop. The iterator stays on the
+// stack while the loop runs and is removed after it.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+
+	hasKey := 0
+	if node.Key != nil {
+		hasKey = 1
+	}
+	c.emit(code.OpIter, hasKey)
+
+	var key Symbol
+	if node.Key != nil {
+		key = c.defineVariable(node.Key.Value)
+	}
+	value := c.defineVariable(node.Value.Value)
+
+	nextPos := c.emit(code.OpIterNext, 9999)
+	c.storeSymbol(value)
+	if node.Key != nil {
+		c.storeSymbol(key)
+	} else {
+		c.emit(code.OpPop)
+	}
+
+	c.enterLoop(nextPos)
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, nextPos)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.changeOperand(nextPos, afterLoopPos)
+	c.leaveLoop(afterLoopPos)
+	c.emit(code.OpPop)
+
+	return nil
+}
+
+func (c *Compiler) enterLoop(continueTarget int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{
+		continueTarget: continueTarget,
+		tries:          len(scope.tries),
+	})
+}
+
+// leaveLoop makes the break statements of the innermost loop jump to
+// afterLoopPos.
+func (c *Compiler) leaveLoop(afterLoopPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, afterLoopPos)
+	}
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// compileTryExpression compiles a try expression. Its finally block is
+// compiled once for every way of leaving the expression: after the try or
+// catch block, before an error raised in them propagates, and before
+// return, break and continue statements jumping out of them.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+	if err := c.compileProtected(node.Block, node.Finally); err != nil {
+		return err
+	}
+	exits := []int{c.emit(code.OpJump, 9999)}
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	// The error raised in the try block is on the stack.
+	if node.Catch != nil {
+		// A constant catch parameter fails before the finally block is
+		// installed, as the evaluator does not run it then.
+		param := c.defineVariable(node.CatchParam.Value)
+		var catchTryPos int
+		if node.Finally != nil {
+			catchTryPos = c.emit(code.OpTry, 9999)
+		}
+		c.emit(code.OpCaught)
+		c.storeSymbol(param)
+
+		if node.Finally == nil {
+			if err := c.compileBlock(node.Catch.Statements, false); err != nil {
+				return err
+			}
+		} else {
+			if err := c.compileProtected(node.Catch, node.Finally); err != nil {
+				return err
+			}
+			exits = append(exits, c.emit(code.OpJump, 9999))
+			c.changeOperand(catchTryPos, len(c.currentInstructions()))
+		}
+	}
+
+	if node.Finally != nil {
+		// Run the finally block and raise the error again.
+		if err := c.compileStatements(node.Finally.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	afterPos := len(c.currentInstructions())
+	for _, pos := range exits {
+		c.changeOperand(pos, afterPos)
+	}
+
+	if node.Finally != nil {
+		return c.compileStatements(node.Finally.Statements)
+	}
+	return nil
+}
+
+// compileProtected compiles the block following an OpTry and removes the
+// handler after it.
+func (c *Compiler) compileProtected(block, finally *ast.BlockStatement) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, finally)
+	err := c.compileBlock(block.Statements, false)
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	return nil
+}
+
+// leaveTries emits the code jumping out of the try blocks entered after
+// the first n of the current function: their handlers are removed and
+// their finally blocks run.
+func (c *Compiler) leaveTries(n int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= n; i-- {
+		c.emit(code.OpEndTry)
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		if tries[i] != nil {
+			if err := c.compileStatements(tries[i].Statements); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	var op code.Opcode
+	compound := node.Operator != "="
+	if compound {
+		var ok bool
+		op, ok = infixOperators[strings.TrimSuffix(node.Operator, "=")]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		format := "identifier not found: %s"
+		if !compound {
+			format = "assignment to undeclared identifier: %s"
+		}
+		symbol, err := c.resolve(target.Value, format)
+		if err != nil {
+			return err
+		}
+		if symbol.Scope == BuiltinScope {
+			return c.errorf("assignment to undeclared identifier: %s", target.Value)
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		if symbol.Const {
+			c.raise("cannot assign to constant: %s", target.Value)
+			return nil
+		}
+		c.emit(code.OpDup)
+		c.assignSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return c.errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+
+	// Parameters without an argument get their default value before the
+	// body runs.
+	numDefaults := 0
+	for i, def := range node.Defaults {
+		if def == nil {
+			continue
+		}
+		numDefaults++
+
+		skipPos := c.emit(code.OpJumpIfSet, i, 9999)
+		if err := c.Compile(def); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, i)
+		c.replaceInstruction(skipPos, c.make(code.OpJumpIfSet, i, len(c.currentInstructions())))
+	}
+
+	if err := c.compileBlock(node.Body.Statements, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	instructions, positions := c.leaveScope()
+
+	if numLocals > 256 {
+		return c.errorf("too many local variables in function")
+	}
+	if len(freeSymbols) > 256 {
+		return c.errorf("too many variables captured by function")
+	}
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		NumDefaults:   numDefaults,
+		Rest:          node.Rest != nil,
+		Name:          node.Name,
+		Source:        c.source(node),
+		Positions:     positions,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) compileCallExpression(node *ast.CallExpression, tail bool) error {
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+
+	for _, a := range node.Arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+	if len(node.Arguments) > 255 {
+		return c.errorf("too many arguments in call")
+	}
+
+	if tail {
+		c.emit(code.OpTailCall, len(node.Arguments))
+	} else {
+		c.emit(code.OpCall, len(node.Arguments))
+	}
+	return nil
+}
+
+// resolve returns the symbol name refers to. In a function, a name not
+// declared yet is taken to be a global declared later, as functions
+// calling each other are. Any other undeclared name is an error made of
+// format and the name.
+func (c *Compiler) resolve(name, format string) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if ok && !symbol.Forward {
+		return symbol, nil
+	}
+	if c.symbolTable.Outer == nil {
+		return Symbol{}, c.errorf(format, name)
+	}
+	c.forwards = append(c.forwards, forward{name: name, pos: c.pos, format: format})
+	return c.symbolTable.Forward(name), nil
+}
+
+// checkForwards reports the first name taken to be a global declared
+// later that the program does not declare.
+func (c *Compiler) checkForwards() error {
+	if c.incremental {
+		return nil
+	}
+	for _, f := range c.forwards {
+		if symbol, ok := c.symbolTable.Resolve(f.name); !ok || symbol.Forward {
+			return &Error{Message: fmt.Sprintf(f.format, f.name), Pos: f.pos}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// storeSymbol emits the instruction declaring s with the value on top of
+// the stack.
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// assignSymbol emits the instruction assigning the value on top of the
+// stack to s.
+func (c *Compiler) assignSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// captureSymbol emits the instruction pushing the variable of s for a
+// closure to share.
+func (c *Compiler) captureSymbol(s Symbol) {
+	if s.Scope == LocalScope {
+		c.emit(code.OpCaptureLocal, s.Index)
+	} else {
+		c.emit(code.OpCaptureFree, s.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := c.make(op, operands...)
+	return c.addInstruction(ins)
+}
+
+// make returns the instruction op with operands, recording an error if
+// an operand does not fit its width.
+func (c *Compiler) make(op code.Opcode, operands ...int) []byte {
+	def, err := code.Lookup(byte(op))
+	if err == nil && c.overflow == nil {
+		for i, o := range operands {
+			if o >= 1<<(8*def.OperandWidths[i]) {
+				c.overflow = c.errorf("%s", overflowMessage(op, def, o))
+				break
+			}
+		}
+	}
+	return code.Make(op, operands...)
+}
+
+// overflowMessage describes the limit an operand o of op exceeds.
+func overflowMessage(op code.Opcode, def *code.Definition, o int) string {
+	switch op {
+	case code.OpConstant, code.OpClosure, code.OpImport, code.OpError:
+		return "too many constants in program"
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+		return "too many global variables"
+	case code.OpArray:
+		return "too many elements in array literal"
+	case code.OpHash:
+		return "too many pairs in hash literal"
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpIfSet, code.OpIterNext, code.OpTry:
+		return "too much code to jump over"
+	default:
+		return fmt.Sprintf("operand %d too large for %s", o, def.Name)
+	}
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos {
+		scope.positions = append(scope.positions, code.SourcePos{
+			Offset: posNewInstruction,
+			Pos:    c.pos,
+		})
+	}
+	scope.instructions = append(scope.instructions, ins...)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := c.make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope.instructions, scope.positions
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Globals:      c.symbolTable.Names(),
+	}
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	Positions    code.SourceMap
+	// Globals holds the names of the global variables by index, for error
+	// messages.
+	Globals []string
+}
@@ -0,0 +1,863 @@
+package compiler
+
+import (
+	"fmt"
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/code"
+	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/parser"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "7 % 3",
+			expectedConstants: []interface{}{7, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			input:             "let one = 1; one = 2; one",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "let one = 1; let one = 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			// Assigning to a constant fails when the assignment runs.
+			input:             "const one = 1; one = 2; one",
+			expectedConstants: []interface{}{1, 2, "cannot assign to constant: one"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpError, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestImports(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `import "lib.mk" as lib; lib.x`,
+			expectedConstants: []interface{}{"lib.mk", "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             `import { a, b as c } from "lib.mk"`,
+			expectedConstants: []interface{}{"lib.mk", "a", "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			input:             "export const k = 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1][0] += 2",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a, b = 1) { a + b }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpJumpIfSet, 1, 9),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input: "len([])",
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let f = fn() { let c = 0; fn() { c } }",
+			expectedConstants: []interface{}{
+				0,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let f = fn(n) { f(n) }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			// A call inside a try block has to return to it.
+			input: "let f = fn(n) { try { f(n) } catch (e) { 0 } }",
+			expectedConstants: []interface{}{
+				0,
+				[]code.Instructions{
+					code.Make(code.OpTry, 14),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpJump, 20),
+					code.Make(code.OpCaught),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		strict   bool
+		expected string
+	}{
+		{"a = 2", false, "1:1: assignment to undeclared identifier: a"},
+		{"let f = fn() { a += 1 }", false, "1:16: identifier not found: a"},
+		{"let a = 1; let f = fn() { let a = 2 }", true, ""},
+		// These fail only when they run.
+		{"const a = 1; let f = fn() { a += 1 }", false, ""},
+		{"const a = 1; let a = 2", false, ""},
+		{"let a = 1; let a = 2", true, ""},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		compiler.SetStrict(tt.strict)
+		err := compiler.Compile(parse(tt.input))
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if _, ok := err.(*Error); !ok {
+			t.Errorf("error for %q is not *Error. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	// repeat joins n copies of s, with # replaced by the number of the
+	// copy, spelled in letters so that it can be part of a name.
+	repeat := func(s string, n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			name := ""
+			for j := i; ; j /= 26 {
+				name += string(rune('a' + j%26))
+				if j < 26 {
+					break
+				}
+			}
+			sb.WriteString(strings.ReplaceAll(s, "#", name))
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[true" + repeat(", true", 69999) + "]", "too many elements in array literal"},
+		{"{true: true" + repeat(", true: true", 39999) + "}", "too many pairs in hash literal"},
+		{repeat("let x# = true; ", 70000), "too many global variables"},
+		{repeat("\"#\"; ", 70000), "too many constants in program"},
+		{"let x = true; if (x) { " + repeat("true; ", 40000) + "}", "too much code to jump over"},
+		{"let x = true; while (x) { " + repeat("true; ", 40000) + "}", "too much code to jump over"},
+		{"[true" + repeat(", true", 65534) + "]", ""},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			continue
+		}
+		compileErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("expected %q, got %T (%v)", tt.expected, err, err)
+			continue
+		}
+		if compileErr.Message != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, compileErr.Message)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("let x = 1;\nx + true")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	// OpAdd follows the let statement and the loads of its operands.
+	pos := bytecode.Positions.Lookup(10)
+	if pos.Line != 2 || pos.Column != 1 {
+		t.Errorf("wrong position for OpAdd. got=%s", pos)
+	}
+}
+
+func TestBinaryFormat(t *testing.T) {
+	compiler := New()
+	input := `let pi = 3.5; let greet = fn(name, punct = "!", ...rest) { "hi " + name + punct };
+greet("x") + pi`
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	if !IsBytecode(data) {
+		t.Fatalf("encoded program does not start with the magic header")
+	}
+
+	decoded := &Bytecode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	if decoded.Instructions.String() != bytecode.Instructions.String() {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q",
+			bytecode.Instructions.String(), decoded.Instructions.String())
+	}
+	if fmt.Sprint(decoded.Globals) != fmt.Sprint(bytecode.Globals) {
+		t.Errorf("wrong globals. want=%v, got=%v", bytecode.Globals, decoded.Globals)
+	}
+	if len(decoded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(bytecode.Constants), len(decoded.Constants))
+	}
+	for i, want := range bytecode.Constants {
+		got := decoded.Constants[i]
+		if wantFn, ok := want.(*object.CompiledFunction); ok {
+			gotFn, ok := got.(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d is not a function. got=%T", i, got)
+				continue
+			}
+			if fmt.Sprintf("%+v", *gotFn) != fmt.Sprintf("%+v", *wantFn) {
+				t.Errorf("constant %d wrong.\nwant=%+v\ngot =%+v", i, *wantFn, *gotFn)
+			}
+			continue
+		}
+		if got.Inspect() != want.Inspect() || got.Type() != want.Type() {
+			t.Errorf("constant %d wrong. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+		}
+	}
+	if fmt.Sprint(decoded.Positions) != fmt.Sprint(bytecode.Positions) {
+		t.Errorf("wrong positions.\nwant=%v\ngot =%v", bytecode.Positions, decoded.Positions)
+	}
+
+	version := append([]byte(Magic), 0, FormatVersion+1)
+	truncated := data[:len(data)-1]
+	// The program refers to a constant past the end of the pool.
+	badConstant, err := (&Bytecode{Instructions: code.Make(code.OpConstant, 5)}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	// The program imports a path that is not a string.
+	badImport, err := (&Bytecode{
+		Instructions: code.Make(code.OpImport, 0),
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled Monkey program"},
+		{version, fmt.Sprintf("unsupported bytecode version %d, want %d", FormatVersion+1, FormatVersion)},
+		{truncated, "truncated bytecode"},
+		{append(append([]byte(nil), data...), 0), "1 bytes of trailing data"},
+		{badConstant, "out of range"},
+		{badImport, "constant 0 is not a string"},
+	}
+
+	for _, tt := range tests {
+		err := (&Bytecode{}).UnmarshalBinary(tt.data)
+		if err == nil {
+			t.Errorf("expected error %q, got none", tt.expected)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestCorruptBytecode(t *testing.T) {
+	fn := func(ins code.Instructions, numLocals, numParameters int) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: ins, NumLocals: numLocals, NumParameters: numParameters}
+	}
+
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue), code.Make(code.OpJump, 2),
+			})},
+			"at 0001: jump target 2 is not an instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpJumpNotTruthy, 100)},
+			"at 0000: jump target 100 is not an instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpTry, 9)},
+			"at 0000: jump target 9 is not an instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetGlobal, 3), Globals: []string{"a"}},
+			"at 0000: global 3 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpSetGlobal, 0)},
+			"at 0000: global 0 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			"at 0000: local 0 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetBuiltin, 200)},
+			"at 0000: builtin 200 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetFree, 0)},
+			"free variable 0 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpHash, 3)},
+			"at 0000: odd number of hash elements 3",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(code.Make(code.OpSetLocal, 1), 1, 1)},
+			},
+			"constant 0: at 0000: local 1 out of range",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(code.Make(code.OpJumpIfSet, 0, 7), 1, 1)},
+			},
+			"constant 0: at 0000: jump target 7 is not an instruction",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(code.Make(code.OpGetFree, 0), 0, 0)},
+			},
+			"constant 0: closure with 0 free variables, function uses 1",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(code.Make(code.OpNull), 1, 2)},
+			},
+			"constant 0: 1 locals do not fit 2 parameters",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshal error: %s", err)
+		}
+		err = (&Bytecode{}).UnmarshalBinary(data)
+		if err == nil {
+			t.Errorf("expected error %q, got none", tt.expected)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("redefined a=%+v, want=%+v", a, expected["a"])
+	}
+
+	local := NewEnclosedSymbolTable(global)
+
+	if c := local.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := local.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.DefineConst("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0, Const: true},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Scope != LocalScope {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	copied := global.Copy()
+	if symbol, ok := copied.Resolve("a"); !ok || symbol != a {
+		t.Errorf("copy does not hold a. got=%+v", symbol)
+	}
+	if b := copied.Define("b"); b.Index != 1 {
+		t.Errorf("wrong index in copy. want=1, got=%d", b.Index)
+	}
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("defining in the copy changed the original")
+	}
+	if c := global.Define("c"); c.Index != 1 {
+		t.Errorf("wrong index in original. want=1, got=%d", c.Index)
+	}
+}
+
+func TestForward(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	forward := local.Forward("later")
+	if forward.Scope != GlobalScope || !forward.Forward {
+		t.Fatalf("wrong forward symbol. got=%+v", forward)
+	}
+	if _, ok := global.Declared("later"); ok {
+		t.Errorf("forward symbol reported as declared")
+	}
+
+	defined := global.Define("later")
+	if defined.Index != forward.Index || defined.Forward {
+		t.Errorf("definition does not take over forward slot. got=%+v", defined)
+	}
+	if names := global.Names(); len(names) != 1 || names[0] != "later" {
+		t.Errorf("wrong names. got=%v", names)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInstructions(
+	expected []code.Instructions,
+	actual code.Instructions,
+) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q",
+			concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q",
+				i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testConstants(
+	expected []interface{},
+	actual []object.Object,
+) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			err := testIntegerObject(int64(constant), actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testIntegerObject failed: %s",
+					i, err)
+			}
+
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - not %q: %s", i, constant, actual[i].Inspect())
+			}
+
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T",
+					i, actual[i])
+			}
+
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s",
+					i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,470 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"playground/go-interpreter/src/code"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/token"
+)
+
+// The binary format of compiled programs is:
+//
+//	magic        "\x7fMKC"
+//	version      uint16, big endian
+//	filenames    count, then each name
+//	globals      count, then the name of each global by index
+//	constants    count, then each constant as a tag byte and its value
+//	instructions length, then the bytes of the main program
+//	positions    count, then offset, filename index, line, column and
+//	             source offset of each entry of the main source map
+//
+// Counts, lengths and integers are varints and strings are a length
+// followed by the bytes. A compiled function constant holds its name,
+// source, number of locals, parameters and defaults, whether it has a rest
+// parameter, and its own instructions and positions.
+
+// Magic starts every compiled program.
+const Magic = "\x7fMKC"
+
+// FormatVersion is the version of the binary format. It changes whenever
+// the format or the instruction set does, as programs compiled for
+// another version cannot run.
+const FormatVersion = 3
+
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagFunction
+)
+
+// IsBytecode reports whether data starts like a compiled program.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// MarshalBinary encodes the bytecode in the binary format.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	e := &encoder{files: make(map[string]int)}
+
+	// The filenames come first but are only known once the source maps
+	// have been seen, so the rest is encoded first.
+	body := &encoder{files: e.files}
+	body.strings(b.Globals)
+	body.uvarint(len(b.Constants))
+	for i, constant := range b.Constants {
+		if err := body.constant(constant); err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+	body.instructions(b.Instructions, b.Positions)
+
+	e.buf.WriteString(Magic)
+	binary.Write(&e.buf, binary.BigEndian, uint16(FormatVersion))
+	e.strings(body.filenames)
+	e.buf.Write(body.buf.Bytes())
+
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf       bytes.Buffer
+	files     map[string]int
+	filenames []string
+}
+
+func (e *encoder) uvarint(n int) {
+	e.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(len(ss))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) constant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.buf.Write(binary.AppendVarint(nil, constant.Value))
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		binary.Write(&e.buf, binary.BigEndian, math.Float64bits(constant.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(constant.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.string(constant.Name)
+		e.string(constant.Source)
+		e.uvarint(constant.NumLocals)
+		e.uvarint(constant.NumParameters)
+		e.uvarint(constant.NumDefaults)
+		if constant.Rest {
+			e.buf.WriteByte(1)
+		} else {
+			e.buf.WriteByte(0)
+		}
+		e.instructions(constant.Instructions, constant.Positions)
+	default:
+		return fmt.Errorf("cannot encode %s", constant.Type())
+	}
+	return nil
+}
+
+func (e *encoder) instructions(ins code.Instructions, positions code.SourceMap) {
+	e.uvarint(len(ins))
+	e.buf.Write(ins)
+
+	e.uvarint(len(positions))
+	for _, p := range positions {
+		file, ok := e.files[p.Pos.Filename]
+		if !ok {
+			file = len(e.filenames)
+			e.files[p.Pos.Filename] = file
+			e.filenames = append(e.filenames, p.Pos.Filename)
+		}
+		e.uvarint(p.Offset)
+		e.uvarint(file)
+		e.uvarint(p.Pos.Line)
+		e.uvarint(p.Pos.Column)
+		e.uvarint(p.Pos.Offset)
+	}
+}
+
+// ErrTruncated is returned for compiled programs that end early.
+var ErrTruncated = errors.New("truncated bytecode")
+
+// UnmarshalBinary decodes a compiled program in the binary format. It
+// checks that the instructions are well formed and that their operands
+// are in range, so that jumps land on an instruction and the constants,
+// variables and builtins they refer to exist. It does not check that the
+// instructions keep the stack balanced.
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsBytecode(data) {
+		return errors.New("not a compiled Monkey program")
+	}
+	data = data[len(Magic):]
+	if len(data) < 2 {
+		return ErrTruncated
+	}
+	if version := binary.BigEndian.Uint16(data); version != FormatVersion {
+		return fmt.Errorf("unsupported bytecode version %d, want %d", version, FormatVersion)
+	}
+
+	d := &decoder{data: data[2:]}
+	d.filenames = d.strings()
+	globals := d.strings()
+
+	n := d.uvarint()
+	var constants []object.Object
+	for i := 0; i < n && d.err == nil; i++ {
+		constants = append(constants, d.constant())
+	}
+
+	ins, positions := d.instructions()
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%d bytes of trailing data", len(d.data))
+	}
+
+	if err := validateProgram(ins, constants, len(globals)); err != nil {
+		return err
+	}
+
+	*b = Bytecode{
+		Instructions: ins,
+		Constants:    constants,
+		Positions:    positions,
+		Globals:      globals,
+	}
+	return nil
+}
+
+// decoder reads the values of a compiled program from data. After the
+// first error, it only returns zero values.
+type decoder struct {
+	data      []byte
+	filenames []string
+	err       error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.data = nil
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data) {
+		d.fail(ErrTruncated)
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uvarint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 || n > math.MaxInt32 {
+		d.fail(ErrTruncated)
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+// count reads the number of elements that follow, which each take at
+// least one byte.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > len(d.data) {
+		d.fail(ErrTruncated)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.count()))
+}
+
+func (d *decoder) strings() []string {
+	n := d.count()
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		if d.err != nil {
+			return nil
+		}
+		n, size := binary.Varint(d.data)
+		if size <= 0 {
+			d.fail(ErrTruncated)
+			return nil
+		}
+		d.data = d.data[size:]
+		return &object.Integer{Value: n}
+	case tagFloat:
+		b := d.bytes(8)
+		if b == nil {
+			return nil
+		}
+		return &object.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(b))}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		fn := &object.CompiledFunction{
+			Name:          d.string(),
+			Source:        d.string(),
+			NumLocals:     d.uvarint(),
+			NumParameters: d.uvarint(),
+			NumDefaults:   d.uvarint(),
+			Rest:          d.byte() == 1,
+		}
+		fn.Instructions, fn.Positions = d.instructions()
+		return fn
+	default:
+		if d.err == nil {
+			d.fail(fmt.Errorf("unknown constant tag %d", tag))
+		}
+		return nil
+	}
+}
+
+func (d *decoder) instructions() (code.Instructions, code.SourceMap) {
+	ins := code.Instructions(d.bytes(d.count()))
+
+	n := d.count()
+	positions := make(code.SourceMap, n)
+	for i := range positions {
+		positions[i].Offset = d.uvarint()
+		file := d.uvarint()
+		if file >= len(d.filenames) && d.err == nil {
+			d.fail(fmt.Errorf("unknown filename %d", file))
+		}
+		if d.err != nil {
+			return nil, nil
+		}
+		positions[i].Pos = token.Position{
+			Filename: d.filenames[file],
+			Line:     d.uvarint(),
+			Column:   d.uvarint(),
+			Offset:   d.uvarint(),
+		}
+	}
+	return ins, positions
+}
+
+// validateProgram checks the main program ins and the functions among
+// its constants, whose closures must get the free variables they use.
+func validateProgram(ins code.Instructions, constants []object.Object, numGlobals int) error {
+	v := &validator{constants: constants, numGlobals: numGlobals, numFree: make(map[int]int)}
+
+	numFree, err := v.validate(ins, 0)
+	if err != nil {
+		return err
+	}
+	if numFree > 0 {
+		return fmt.Errorf("free variable %d out of range", numFree-1)
+	}
+
+	uses := make(map[int]int) // free variables by function constant
+	for i, constant := range constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		params := fn.NumParameters
+		if fn.Rest {
+			params++
+		}
+		if fn.NumDefaults > fn.NumParameters || params > fn.NumLocals || fn.NumLocals > 256 {
+			return fmt.Errorf("constant %d: %d locals do not fit %d parameters with %d defaults",
+				i, fn.NumLocals, params, fn.NumDefaults)
+		}
+		if uses[i], err = v.validate(fn.Instructions, fn.NumLocals); err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	for i := range constants {
+		if n, ok := v.numFree[i]; ok && n < uses[i] {
+			return fmt.Errorf("constant %d: closure with %d free variables, function uses %d", i, n, uses[i])
+		}
+	}
+	return nil
+}
+
+// validator checks the instructions of a compiled program before it
+// runs, as the virtual machine trusts their operands.
+type validator struct {
+	constants  []object.Object
+	numGlobals int
+	// numFree holds, by constant index, the fewest free variables the
+	// closures of a function are created with.
+	numFree map[int]int
+}
+
+// validate checks that ins, the instructions of the main program or of a
+// function with numLocals locals, is a sequence of complete instructions
+// whose operands are in range: jumps land on an instruction, and the
+// constants, globals, builtins and locals they refer to exist. It returns
+// the number of free variables the instructions need.
+func (v *validator) validate(ins code.Instructions, numLocals int) (int, error) {
+	starts := make([]bool, len(ins)+1)
+	starts[len(ins)] = true
+	jumps := map[int]int{} // targets by the offset of the jump
+	numFree := 0
+
+	for i := 0; i < len(ins); {
+		starts[i] = true
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return 0, fmt.Errorf("at %04d: %w", i, err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return 0, fmt.Errorf("at %04d: %s: %w", i, def.Name, ErrTruncated)
+		}
+
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			if operands[0] >= len(v.constants) {
+				return 0, fmt.Errorf("at %04d: constant %d out of range", i, operands[0])
+			}
+		case code.OpClosure:
+			if operands[0] >= len(v.constants) {
+				return 0, fmt.Errorf("at %04d: constant %d out of range", i, operands[0])
+			}
+			if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+				return 0, fmt.Errorf("at %04d: constant %d is not a function", i, operands[0])
+			}
+			if n, ok := v.numFree[operands[0]]; !ok || operands[1] < n {
+				v.numFree[operands[0]] = operands[1]
+			}
+		case code.OpImport, code.OpError:
+			if operands[0] >= len(v.constants) {
+				return 0, fmt.Errorf("at %04d: constant %d out of range", i, operands[0])
+			}
+			if _, ok := v.constants[operands[0]].(*object.String); !ok {
+				return 0, fmt.Errorf("at %04d: constant %d is not a string", i, operands[0])
+			}
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			if operands[0] >= v.numGlobals {
+				return 0, fmt.Errorf("at %04d: global %d out of range", i, operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+			if operands[0] >= numLocals {
+				return 0, fmt.Errorf("at %04d: local %d out of range", i, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return 0, fmt.Errorf("at %04d: builtin %d out of range", i, operands[0])
+			}
+		case code.OpGetFree, code.OpSetFree, code.OpCaptureFree:
+			if operands[0] >= numFree {
+				numFree = operands[0] + 1
+			}
+		case code.OpHash:
+			if operands[0]%2 != 0 {
+				return 0, fmt.Errorf("at %04d: odd number of hash elements %d", i, operands[0])
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext, code.OpTry:
+			jumps[i] = operands[0]
+		case code.OpJumpIfSet:
+			if operands[0] >= numLocals {
+				return 0, fmt.Errorf("at %04d: local %d out of range", i, operands[0])
+			}
+			jumps[i] = operands[1]
+		}
+
+		i += 1 + width
+	}
+
+	for i, target := range jumps {
+		if target >= len(starts) || !starts[target] {
+			return 0, fmt.Errorf("at %04d: jump target %d is not an instruction", i, target)
+		}
+	}
+	return numFree, nil
+}
@@ -0,0 +1,164 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool
+	// Forward marks a global that is used before it is declared, such as
+	// a function called by another one defined before it.
+	Forward bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// FreeSymbols are the symbols of enclosing functions used in this
+	// one, in the order of the free variables of its closures.
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	return &SymbolTable{store: s}
+}
+
+// Copy returns a copy of the global scope s, which a program can be
+// compiled against without declaring anything in s.
+func (s *SymbolTable) Copy() *SymbolTable {
+	store := make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		store[name] = symbol
+	}
+	return &SymbolTable{store: store, numDefinitions: s.numDefinitions}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define declares name in this scope. Declaring a name again reuses its
+// slot, so code compiled earlier sees the new value.
+func (s *SymbolTable) Define(name string) Symbol {
+	return s.define(name, false)
+}
+
+// DefineConst declares name as a constant in this scope.
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	return s.define(name, true)
+}
+
+func (s *SymbolTable) define(name string, constant bool) Symbol {
+	symbol, ok := s.store[name]
+	if !ok || symbol.Scope != s.scope() {
+		symbol = Symbol{Name: name, Scope: s.scope(), Index: s.numDefinitions}
+		s.numDefinitions++
+	}
+	symbol.Const = constant
+	symbol.Forward = false
+
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) scope() SymbolScope {
+	if s.Outer == nil {
+		return GlobalScope
+	}
+	return LocalScope
+}
+
+// Declared returns the symbol name was declared as in this scope.
+func (s *SymbolTable) Declared(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok || symbol.Scope != s.scope() || symbol.Forward {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+// Forward reserves a global for name, which the program uses before
+// declaring it. Whether it has been declared by the time it is used is
+// only known when the program runs.
+func (s *SymbolTable) Forward(name string) Symbol {
+	global := s
+	for global.Outer != nil {
+		global = global.Outer
+	}
+
+	symbol, ok := global.store[name]
+	if !ok {
+		symbol = Symbol{Name: name, Scope: GlobalScope, Index: global.numDefinitions, Forward: true}
+		global.numDefinitions++
+		global.store[name] = symbol
+	}
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{
+		Name:  original.Name,
+		Index: len(s.FreeSymbols) - 1,
+		Scope: FreeScope,
+		Const: original.Const,
+	}
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
+
+// NumDefinitions returns the number of slots the scope needs.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Names returns the names of the variables of the scope by slot.
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == s.scope() {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
@@ -2,17 +2,81 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
 	"playground/go-interpreter/src/ast"
 	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/resolver"
+	"playground/go-interpreter/src/token"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = object.NULL
+	TRUE     = object.TRUE
+	FALSE    = object.FALSE
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return locateError(eval(node, env), node, env)
+}
+
+// locateError records where an error result happened. Only the innermost
+// node producing the error sets its location.
+func locateError(result object.Object, node ast.Node, env *object.Environment) object.Object {
+	if err, ok := result.(*object.Error); ok && err.Stack == nil {
+		err.Pos = node.Pos()
+		err.Stack = env.Frame().Stack()
+	}
+	return result
+}
+
+// evalTail evaluates node in tail position of a function body. A call
+// to a Monkey function found there is not made, but returned as a tail
+// call for applyFunction to run without growing the Go stack.
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		result = evalBlockStatement(node, env, true)
+	case *ast.ExpressionStatement:
+		result = evalTail(node.Expression, env)
+	case *ast.IfExpression:
+		result = evalIfExpression(node, env, true)
+	case *ast.CallExpression:
+		result = evalCallExpression(node, env, true)
+	default:
+		return Eval(node, env)
+	}
+
+	return locateError(result, node, env)
+}
+
+// SafeEval evaluates node like Eval, but turns a Go panic during the
+// evaluation into an internal error instead of crashing the process.
+func SafeEval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer recoverPanic(&result, node.Pos(), env)
+	return Eval(node, env)
+}
+
+// recoverPanic converts a panic into an internal error stored in result,
+// raised at pos with the Monkey call stack of env.
+func recoverPanic(result *object.Object, pos token.Position, env *object.Environment) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	*result = &object.Error{
+		Message:  fmt.Sprintf("internal error: %v", r),
+		Pos:      pos,
+		Stack:    env.Frame().Stack(),
+		Internal: true,
+	}
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// Statements
@@ -20,29 +84,65 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, env, false)
 
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		var val object.Object
+		if env.Frame() != nil {
+			// The value returned from a function is in tail position.
+			val = evalTail(node.ReturnValue, env)
+		} else {
+			val = Eval(node.ReturnValue, env)
+		}
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.Error{Message: object.ThrownMessage(val), Value: val}
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if err := declare(node.Name, val, node.IsConst(), env); err != nil {
+			return err
+		}
+
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -54,9 +154,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -67,31 +171,32 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return evalIfExpression(node, env, false)
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
-
-	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		return &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        env,
+			Body:       node.Body,
+			Name:       node.Name,
 		}
 
-		return applyFunction(function, args)
+	case *ast.CallExpression:
+		return evalCallExpression(node, env, false)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -119,7 +224,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+// evalProgram resolves the identifiers of program and runs it. A program
+// using an undeclared identifier does not run at all.
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if err := resolver.Resolve(program, env); err != nil {
+		resolveErr := err.(*resolver.Error)
+		return &object.Error{
+			Message: resolveErr.Message,
+			Pos:     resolveErr.Pos,
+			Stack:   env.Frame().Stack(),
+		}
+	}
+
 	var result object.Object
 
 	for _, statement := range program.Statements {
@@ -136,18 +252,26 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
+// evalBlockStatement evaluates the statements of block. When the block
+// is in tail position, so is its last statement.
 func evalBlockStatement(
 	block *ast.BlockStatement,
 	env *object.Environment,
+	tail bool,
 ) object.Object {
 	var result object.Object
 
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+	for i, statement := range block.Statements {
+		if tail && i == len(block.Statements)-1 {
+			result = evalTail(statement, env)
+		} else {
+			result = Eval(statement, env)
+		}
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -163,24 +287,31 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(
+	operator string,
+	right object.Object,
+	env *object.Environment,
+) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, env)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return object.NewError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
 func evalInfixExpression(
 	operator string,
 	left, right object.Object,
+	env *object.Environment,
 ) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, env)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -188,10 +319,10 @@ func evalInfixExpression(
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return object.NewError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return object.NewError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -209,51 +340,121 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+func evalMinusPrefixOperatorExpression(
+	right object.Object,
+	env *object.Environment,
+) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if env.CheckedArithmetic() && right.Value == math.MinInt64 {
+			return object.NewError("integer overflow: -(%d)", right.Value)
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return object.NewError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
+// evalIntegerInfixExpression handles operators on two integers. Integer
+// arithmetic wraps around on overflow unless the environment asks for
+// checked arithmetic, in which case overflow is an error.
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
+	env *object.Environment,
 ) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	switch operator {
+	case "+", "-", "*", "/", "%":
+		if (operator == "/" || operator == "%") && rightVal == 0 {
+			return object.NewError("division by zero: %d %s %d", leftVal, operator, rightVal)
+		}
+		result, overflow := object.IntegerArithmetic(operator, leftVal, rightVal)
+		if overflow && env.CheckedArithmetic() {
+			return object.NewError("integer overflow: %d %s %d", leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: result}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return object.NewError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression handles arithmetic and comparisons where at
+// least one operand is a float; integer operands are converted.
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return object.NewError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
+		return object.NewError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 
@@ -262,54 +463,391 @@ func evalStringInfixExpression(
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// evalLogicalExpression evaluates && and ||. The right operand is only
+// evaluated when the left one does not already decide the result.
+func evalLogicalExpression(
+	ie *ast.InfixExpression,
+	env *object.Environment,
+) object.Object {
+	left := Eval(ie.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if ie.Operator == "&&" && !object.IsTruthy(left) {
+		return FALSE
+	}
+	if ie.Operator == "||" && object.IsTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(ie.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(object.IsTruthy(right))
+}
+
+func evalWhileStatement(
+	ws *ast.WhileStatement,
+	env *object.Environment,
+) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !object.IsTruthy(condition) {
+			return NULL
+		}
+
+		if result, stop := loopControl(Eval(ws.Body, env)); stop {
+			return result
+		}
+	}
+}
+
+func evalForStatement(
+	fs *ast.ForStatement,
+	env *object.Environment,
+) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var keys, values []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		values = append(values, iterable.Elements...)
+		for i := range values {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+	case *object.String:
+		i := 0
+		for _, r := range iterable.Value {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+			values = append(values, &object.String{Value: string(r)})
+			i++
+		}
+	default:
+		return object.NewError("cannot iterate over %s", iterable.Type())
+	}
+
+	// A single loop variable gets the keys of a hash and the elements of
+	// arrays and strings.
+	if _, ok := iterable.(*object.Hash); ok && fs.Key == nil {
+		values = keys
+	}
+
+	for _, ident := range []*ast.Identifier{fs.Key, fs.Value} {
+		if ident != nil && env.DefinesAt(ident.Binding.Slot) && env.IsConstAt(0, ident.Binding.Slot) {
+			return object.NewError("cannot assign to constant: %s", ident.Value)
+		}
+	}
+
+	for i := range values {
+		if fs.Key != nil {
+			env.SetAt(fs.Key.Binding.Slot, keys[i])
+		}
+		env.SetAt(fs.Value.Binding.Slot, values[i])
+
+		if result, stop := loopControl(Eval(fs.Body, env)); stop {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// loopControl inspects the result of a loop body and reports whether the
+// loop has to stop, along with the value the loop then evaluates to.
+// Return values and errors keep unwinding past the loop.
+func loopControl(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
 func evalIfExpression(
 	ie *ast.IfExpression,
 	env *object.Environment,
+	tail bool,
 ) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+	var branch *ast.BlockStatement
+	if object.IsTruthy(condition) {
+		branch = ie.Consequence
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		branch = ie.Alternative
 	} else {
 		return NULL
 	}
+
+	if tail {
+		return evalTail(branch, env)
+	}
+	return Eval(branch, env)
 }
 
-func evalIdentifier(
-	node *ast.Identifier,
+func evalTryExpression(
+	te *ast.TryExpression,
 	env *object.Environment,
 ) object.Object {
-	if val, ok := env.Get(node.Value); ok {
+	result := resolveTailCall(Eval(te.Block, env), env)
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		param := te.CatchParam
+		if env.DefinesAt(param.Binding.Slot) && env.IsConstAt(0, param.Binding.Slot) {
+			return object.NewError("cannot assign to constant: %s", param.Value)
+		}
+		env.SetAt(param.Binding.Slot, object.CaughtError(err))
+		result = resolveTailCall(Eval(te.Catch, env), env)
+	}
+
+	if te.Finally != nil {
+		// Leaving the finally block early overrides the outcome of the
+		// try and catch blocks.
+		final := Eval(te.Finally, env)
+		if final != nil {
+			switch final.Type() {
+			case object.ERROR_OBJ, object.RETURN_VALUE_OBJ,
+				object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return final
+			}
+		}
+	}
+
+	return result
+}
+
+// resolveTailCall makes a call returned from inside a try expression
+// right away: it has to run while the try expression can still catch its
+// errors and before the finally block.
+func resolveTailCall(result object.Object, env *object.Environment) object.Object {
+	rv, ok := result.(*object.ReturnValue)
+	if !ok {
+		return result
+	}
+	tc, ok := rv.Value.(*object.TailCall)
+	if !ok {
+		return result
+	}
+
+	val := applyFunction(tc.Function, tc.Arguments, tc.Call, env)
+	if isError(val) {
 		return val
 	}
+	return &object.ReturnValue{Value: val}
+}
+
+func evalAssignExpression(
+	ae *ast.AssignExpression,
+	env *object.Environment,
+) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		val := Eval(ae.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if ae.Operator != "=" {
+			current := evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+			val = evalCompoundOperator(ae.Operator, current, val, env)
+			if isError(val) {
+				return val
+			}
+		}
+
+		binding := target.Binding
+		if env.IsConstAt(binding.Depth, binding.Slot) {
+			return object.NewError("cannot assign to constant: %s", target.Value)
+		}
+		if _, ok := env.AssignAt(binding.Depth, binding.Slot, val); !ok {
+			return object.NewError("assignment to undeclared identifier: %s", target.Value)
+		}
+		return val
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		val := Eval(ae.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if ae.Operator != "=" {
+			current := evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+			val = evalCompoundOperator(ae.Operator, current, val, env)
+			if isError(val) {
+				return val
+			}
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return object.NewError("cannot assign to %s", ae.Target.String())
 	}
+}
 
-	return newError("identifier not found: " + node.Value)
+// evalCompoundOperator applies the operator of a compound assignment such
+// as += to the current and the assigned value.
+func evalCompoundOperator(
+	operator string,
+	current, val object.Object,
+	env *object.Environment,
+) object.Object {
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), current, val, env)
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return object.NewError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return object.NewError("index out of range: %d", idx.Value)
+		}
+		left.SetElement(int(idx.Value), val)
+		return val
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return object.NewError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, val)
+		return val
+
 	default:
-		return true
+		return object.NewError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// evalImportStatement loads the module of node and binds it, or the
+// exports it names, like a let statement would.
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	importer := env.Importer()
+	if importer == nil {
+		return object.NewError("cannot import %q: modules are not available", node.Path.Value)
+	}
+	module, err := importer.Import(node.Path.Value, node.Pos().Filename)
+	if err != nil {
+		if err, ok := err.(*object.Error); ok {
+			return err
+		}
+		return object.NewError("%s", err)
+	}
+
+	if node.Name != nil {
+		if err := declare(node.Name, module, false, env); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	for _, m := range node.Members {
+		val := evalModuleMember(module, m.Export.Value)
+		if isError(val) {
+			return locateError(val, m, env)
+		}
+		if err := declare(m.Name, val, false, env); err != nil {
+			return locateError(err, m, env)
+		}
+	}
+	return nil
+}
+
+func evalModuleMember(module *object.Module, name string) object.Object {
+	if val, ok := module.Get(name); ok {
+		return val
+	}
+	return object.NewError("module %s has no export %s", module.Path, name)
+}
+
+// declare binds the variable declared by name to val, unless name may
+// not be declared in env.
+func declare(name *ast.Identifier, val object.Object, constant bool, env *object.Environment) *object.Error {
+	if err := checkDeclaration(name, env); err != nil {
+		return err
+	}
+	if constant {
+		env.SetConstAt(name.Binding.Slot, val)
+	} else {
+		env.SetAt(name.Binding.Slot, val)
+	}
+	env.SetSiteAt(name.Binding.Slot, name)
+	return nil
+}
+
+// checkDeclaration returns an error if name may not be declared in env:
+// constants can never be redeclared in their scope, and in strict mode
+// no name can. A declaration that runs again, as one in a loop body does
+// on every iteration, only replaces its own binding.
+func checkDeclaration(name *ast.Identifier, env *object.Environment) *object.Error {
+	if !env.DefinesAt(name.Binding.Slot) || env.SiteAt(name.Binding.Slot) == name {
+		return nil
+	}
+	if env.IsConstAt(0, name.Binding.Slot) {
+		return object.NewError("cannot redeclare constant: %s", name.Value)
+	}
+	if env.Strict() {
+		return object.NewError("identifier already declared: %s", name.Value)
 	}
+	return nil
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// evalIdentifier returns the value of the variable or the builtin the
+// resolver bound node to. A variable declared later in its scope may not
+// be set yet.
+func evalIdentifier(
+	node *ast.Identifier,
+	env *object.Environment,
+) object.Object {
+	switch node.Binding.Kind {
+	case ast.Variable:
+		if val, ok := env.GetAt(node.Binding.Depth, node.Binding.Slot); ok {
+			return val
+		}
+	case ast.Builtin:
+		return object.Builtins[node.Binding.Slot].Builtin
+	}
+
+	return object.NewError("identifier not found: " + node.Value)
 }
 
 func isError(obj object.Object) bool {
@@ -336,39 +874,159 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalCallExpression evaluates a call. In tail position a call to a
+// Monkey function is returned as an *object.TailCall instead of being made.
+func evalCallExpression(
+	node *ast.CallExpression,
+	env *object.Environment,
+	tail bool,
+) object.Object {
+	function := Eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if fn, ok := function.(*object.Function); ok && tail {
+		return &object.TailCall{Function: fn, Arguments: args, Call: node}
+	}
+	return applyFunction(function, args, node, env)
+}
+
+func applyFunction(
+	fn object.Object,
+	args []object.Object,
+	call *ast.CallExpression,
+	env *object.Environment,
+) (result object.Object) {
+	// A panic in a builtin or in the function body is reported at the
+	// innermost call, along with the Monkey calls leading to it.
+	defer recoverPanic(&result, call.Pos(), env)
+
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		caller := env.Frame()
+		depth := 1
+		if caller != nil {
+			depth = caller.Depth + 1
+		}
+
+		// Tail calls made by the body replace the frame of the function
+		// instead of nesting inside it. The frame keeps the site of the
+		// call that created it and counts the tail calls it went through.
+		callSite := call.Pos()
+		for tailCalls := 0; ; tailCalls++ {
+			frame := &object.Frame{
+				Function:  fn.Name,
+				CallSite:  callSite,
+				Caller:    caller,
+				Depth:     depth,
+				TailCalls: tailCalls,
+			}
+			if depth > env.MaxCallDepth() {
+				return object.NewError("maximum recursion depth exceeded calling %s (limit %d)",
+					frame.FunctionName(), env.MaxCallDepth())
+			}
+			extendedEnv, err := extendFunctionEnv(fn, args, frame)
+			if err != nil {
+				return locateError(err, call, env)
+			}
+
+			evaluated := unwrapReturnValue(evalTail(fn.Body, extendedEnv))
+			tc, ok := evaluated.(*object.TailCall)
+			if !ok {
+				return evaluated
+			}
+			fn, args, call = tc.Function, tc.Arguments, tc.Call
+		}
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return object.NewError("not a function: %s", fn.Type())
 	}
 }
 
+// extendFunctionEnv binds the arguments of a call to the parameters of
+// fn. Missing arguments take their default value, which is evaluated in
+// the call environment so it can refer to earlier parameters, and extra
+// arguments go to the rest parameter.
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	frame *object.Frame,
+) (*object.Environment, *object.Error) {
+	if err := checkArity(fn, len(args), frame); err != nil {
+		return nil, err
+	}
+
+	env := object.NewCallEnvironment(fn.Env, frame)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.SetAt(param.Binding.Slot, args[paramIdx])
+			continue
+		}
+		val := Eval(fn.Defaults[paramIdx], env)
+		if err, ok := val.(*object.Error); ok {
+			return nil, err
+		}
+		env.SetAt(param.Binding.Slot, val)
 	}
 
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.SetAt(fn.Rest.Binding.Slot, &object.Array{Elements: rest})
+	}
+
+	return env, nil
 }
 
+// checkArity returns an error if fn cannot be called with n arguments.
+func checkArity(fn *object.Function, n int, frame *object.Frame) *object.Error {
+	max := len(fn.Parameters)
+	min := max
+	for min > 0 && min <= len(fn.Defaults) && fn.Defaults[min-1] != nil {
+		min--
+	}
+
+	var want string
+	switch {
+	case n >= min && (n <= max || fn.Rest != nil):
+		return nil
+	case fn.Rest != nil:
+		want = fmt.Sprintf("at least %d", min)
+	case min == max:
+		want = fmt.Sprintf("%d", max)
+	default:
+		want = fmt.Sprintf("%d to %d", min, max)
+	}
+	return object.NewError("wrong number of arguments to %s: want=%s, got=%d",
+		frame.FunctionName(), want, n)
+}
+
+// unwrapReturnValue returns the value of a function call whose body
+// evaluated to obj: that of its return statement, or null for a body
+// without any expression, such as an empty one.
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
 	}
+	if obj == nil {
+		return NULL
+	}
 
 	return obj
 }
@@ -379,8 +1037,10 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleMember(left.(*object.Module), index.(*object.String).Value)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return object.NewError("index operator not supported: %s", left.Type())
 	}
 }
 
@@ -400,29 +1060,28 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return object.NewError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
@@ -430,13 +1089,13 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return object.NewError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
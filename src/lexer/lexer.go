@@ -1,21 +1,37 @@
 package lexer
 
-import "playground/go-interpreter/src/token"
+import (
+	"playground/go-interpreter/src/token"
+	"strings"
+)
 
 type Lexer struct {
+	filename     string
 	input        string
 	readPosition int
 	position     int
 	ch           byte
+	line         int
+	column       int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename creates a lexer whose token positions refer to filename.
+func NewWithFilename(filename, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -24,6 +40,23 @@ func (l *Lexer) readChar() {
 
 	l.position = l.readPosition
 	l.readPosition++
+	if l.position <= len(l.input) {
+		l.column++
+	}
+}
+
+// currentPosition returns the position of l.ch.
+func (l *Lexer) currentPosition() token.Position {
+	offset := l.position
+	if offset > len(l.input) {
+		offset = len(l.input)
+	}
+	return token.Position{
+		Filename: l.filename,
+		Offset:   offset,
+		Line:     l.line,
+		Column:   l.column,
+	}
 }
 
 func (l *Lexer) peekChar() byte {
@@ -36,6 +69,7 @@ func (l *Lexer) peekChar() byte {
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
@@ -47,9 +81,9 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.newAssignToken(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.newAssignToken(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -59,13 +93,43 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.newAssignToken(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.newAssignToken(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '%':
+		tok = l.newAssignToken(token.PERCENT, token.PERCENT_ASSIGN)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
@@ -90,14 +154,23 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	default:
 		if isChar(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupKeyword(tok.Literal)
+			tok.Pos, tok.End = pos, l.currentPosition()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos, tok.End = pos, l.currentPosition()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -105,6 +178,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos, tok.End = pos, l.currentPosition()
 	return tok
 }
 
@@ -115,6 +189,17 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	}
 }
 
+// newAssignToken returns a token of type compound if the current character
+// is followed by '=' and a token of type simple otherwise.
+func (l *Lexer) newAssignToken(simple, compound token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: compound, Literal: string(ch) + string(l.ch)}
+	}
+	return newToken(simple, l.ch)
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isChar(l.ch) {
@@ -123,12 +208,40 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float literal. Floats need digits on
+// both sides of the decimal point and may carry an exponent: 3.14, 1e-9.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	typ := token.TokenType(token.INT)
+
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		typ = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.readPosition
+		if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+			next++
+		}
+		if next < len(l.input) && isDigit(l.input[next]) {
+			typ = token.FLOAT
+			for l.readPosition < next {
+				l.readChar()
+			}
+			l.readChar()
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], typ
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
 func (l *Lexer) skipWhitespace() {
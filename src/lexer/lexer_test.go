@@ -236,3 +236,137 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestNextTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  "ab" == y`
+
+	testCases := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedStart  int
+		expectedEnd    int
+	}{
+		{token.LET, 1, 1, 0, 3},
+		{token.IDENT, 1, 5, 4, 5},
+		{token.ASSIGN, 1, 7, 6, 7},
+		{token.INT, 1, 9, 8, 9},
+		{token.SEMICOLON, 1, 10, 9, 10},
+		{token.STRING, 2, 3, 13, 17},
+		{token.EQ, 2, 8, 18, 20},
+		{token.IDENT, 2, 11, 21, 22},
+		{token.EOF, 2, 12, 22, 22},
+	}
+
+	l := NewWithFilename("test.mk", input)
+
+	for _, tc := range testCases {
+		tok := l.NextToken()
+
+		if tok.Type != tc.expectedType {
+			t.Fatalf("expected %v, but got %v instead", tc.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Filename != "test.mk" {
+			t.Errorf("expected filename test.mk, but got %q instead", tok.Pos.Filename)
+		}
+
+		if tok.Pos.Line != tc.expectedLine || tok.Pos.Column != tc.expectedColumn {
+			t.Errorf("expected %q at %d:%d, but got %d:%d instead", tok.Literal,
+				tc.expectedLine, tc.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.Offset != tc.expectedStart || tok.End.Offset != tc.expectedEnd {
+			t.Errorf("expected %q to span [%d, %d), but got [%d, %d) instead", tok.Literal,
+				tc.expectedStart, tc.expectedEnd, tok.Pos.Offset, tok.End.Offset)
+		}
+	}
+}
+
+func TestNumberTokens(t *testing.T) {
+	input := `5 3.14 0.5 1e9 1e-9 2.5E+3 7.method 4e`
+
+	testCases := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "7"},
+		{token.DOT, "."},
+		{token.IDENT, "method"},
+		{token.INT, "4"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for _, tc := range testCases {
+		tok := l.NextToken()
+
+		if tok.Type != tc.expectedType {
+			t.Errorf("expected %v, but got %v instead", tc.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tc.expectedLiteral {
+			t.Errorf("expected %v, but got %v instead", tc.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestOperatorTokens(t *testing.T) {
+	input := `a <= b >= c % d && e || f < g > h & | += -= *= /= %= = ...rest .`
+
+	testCases := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.LT, "<"},
+		{token.IDENT, "g"},
+		{token.GT, ">"},
+		{token.IDENT, "h"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.ASSIGN, "="},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.DOT, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for _, tc := range testCases {
+		tok := l.NextToken()
+
+		if tok.Type != tc.expectedType {
+			t.Errorf("expected %v, but got %v instead", tc.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tc.expectedLiteral {
+			t.Errorf("expected %v, but got %v instead", tc.expectedLiteral, tok.Literal)
+		}
+	}
+}
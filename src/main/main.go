@@ -2,18 +2,307 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"playground/go-interpreter/src/compiler"
+	"playground/go-interpreter/src/monkey"
+	"playground/go-interpreter/src/object"
 	"playground/go-interpreter/src/repl"
 )
 
+// Exit codes of the monkey command.
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitUsage        = 2
+	exitSyntaxError  = 3
+)
+
+const usage = `Usage:
+  monkey                                    start the interactive REPL
+  monkey [options] run <file.mk> [args...]  run a script
+  monkey [options] -e <program> [args...]   run a program given on the command line
+  monkey [options] build <file.mk> [-o <file.mkc>]
+                                            compile a script to bytecode
+
+Options:
+  --strict   reject declaring a name twice in the same scope
+  --checked  make integer overflow a runtime error instead of wrapping around
+  --optimize fold constants and remove dead code before running; results
+             and errors stay the same
+  --max-depth=<n>
+             limit the nesting of function calls (default 10000, at most
+             50000)
+  --engine=<eval|vm>
+             evaluate the syntax tree directly (default) or compile the
+             program to bytecode and run it on the virtual machine
+
+Compiled scripts (.mkc) are run with "monkey run" like any other script
+and always run on the virtual machine. They import modules relative to
+the script they were built from.
+Script arguments are available to the program in the "args" array.
+Modules are imported relative to the importing file, or else from the
+directories listed in MONKEY_PATH.
+Exit status is 1 on runtime errors, 2 on usage errors and 3 on syntax errors.
+`
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// options holds the settings given before the command.
+type options struct {
+	strict   bool
+	checked  bool
+	optimize bool
+	maxDepth int
+	engine   monkey.Engine
+}
+
+// parseOptions consumes the leading --options of argv and returns the
+// remaining arguments.
+func parseOptions(argv []string) (options, []string, error) {
+	var opts options
+	for len(argv) > 0 && strings.HasPrefix(argv[0], "--") && argv[0] != "--help" {
+		name, value, hasValue := strings.Cut(argv[0], "=")
+		if hasValue != (name == "--max-depth" || name == "--engine") {
+			return opts, nil, fmt.Errorf("invalid option %s", argv[0])
+		}
+
+		switch name {
+		case "--max-depth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth <= 0 {
+				return opts, nil, fmt.Errorf("invalid call depth %q", value)
+			}
+			if depth > object.MaxCallDepthLimit {
+				return opts, nil, fmt.Errorf("invalid call depth %q (at most %d)", value, object.MaxCallDepthLimit)
+			}
+			opts.maxDepth = depth
+		case "--engine":
+			switch value {
+			case "eval":
+				opts.engine = monkey.Evaluator
+			case "vm":
+				opts.engine = monkey.VM
+			default:
+				return opts, nil, fmt.Errorf("unknown engine %q", value)
+			}
+		case "--strict":
+			opts.strict = true
+		case "--checked":
+			opts.checked = true
+		case "--optimize":
+			opts.optimize = true
+		default:
+			return opts, nil, fmt.Errorf("unknown option %s", argv[0])
+		}
+		argv = argv[1:]
+	}
+	return opts, argv, nil
+}
+
+func run(argv []string, stdout, stderr io.Writer) int {
+	opts, argv, err := parseOptions(argv)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if len(argv) == 0 {
+		startRepl(opts)
+		return exitOK
+	}
+
+	switch argv[0] {
+	case "run":
+		if len(argv) < 2 {
+			fmt.Fprint(stderr, usage)
+			return exitUsage
+		}
+		source, err := os.ReadFile(argv[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return exitUsage
+		}
+		if compiler.IsBytecode(source) {
+			return executeBytecode(argv[1], source, argv[2:], opts, stdout, stderr)
+		}
+		return execute(argv[1], string(source), argv[2:], opts, false, stdout, stderr)
+
+	case "build":
+		return build(argv[1:], opts, stderr)
+
+	case "-e":
+		if len(argv) < 2 {
+			fmt.Fprint(stderr, usage)
+			return exitUsage
+		}
+		return execute("-e", argv[1], argv[2:], opts, true, stdout, stderr)
+
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+
+	default:
+		fmt.Fprintf(stderr, "monkey: unknown command %q\n", argv[0])
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+}
+
+// execute parses and evaluates source. When printResult is set the value
+// of the program is written to stdout, unless it is null.
+func execute(
+	filename, source string,
+	args []string,
+	opts options,
+	printResult bool,
+	stdout, stderr io.Writer,
+) int {
+	interp := newInterpreter(opts, args)
+	evaluated, err := interp.Run(filename, source)
+	return report(evaluated, err, printResult, stdout, stderr)
+}
+
+// executeBytecode runs a script compiled by the build command.
+func executeBytecode(
+	filename string,
+	data []byte,
+	args []string,
+	opts options,
+	stdout, stderr io.Writer,
+) int {
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s: %s\n", filename, err)
+		return exitUsage
+	}
+
+	interp := newInterpreter(opts, args)
+	evaluated, err := interp.RunBytecode(bytecode)
+	return report(evaluated, err, false, stdout, stderr)
+}
+
+// build compiles a script to bytecode. The output file is given with -o
+// and defaults to the script with the extension .mkc.
+func build(argv []string, opts options, stderr io.Writer) int {
+	var input, output string
+	for i := 0; i < len(argv); i++ {
+		switch {
+		case argv[i] == "-o" && i+1 < len(argv) && output == "":
+			output = argv[i+1]
+			i++
+		case input == "" && !strings.HasPrefix(argv[i], "-"):
+			input = argv[i]
+		default:
+			fmt.Fprint(stderr, usage)
+			return exitUsage
+		}
+	}
+	if input == "" {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + ".mkc"
+	}
+
+	source, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+
+	// The compiled script imports modules relative to the script it was
+	// built from, wherever it runs, so the script is recorded by its
+	// absolute path.
+	filename, err := filepath.Abs(input)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+	bytecode, err := newInterpreter(opts, nil).Compile(filename, string(source))
+	if err != nil {
+		return report(nil, err, false, nil, stderr)
+	}
+	data, err := bytecode.MarshalBinary()
+	if err == nil {
+		err = os.WriteFile(output, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+	return exitOK
+}
+
+func newInterpreter(opts options, args []string) *monkey.Interpreter {
+	interp := monkey.New(interpreterOptions(opts))
+	interp.Define("args", scriptArgs(args))
+	return interp
+}
+
+// interpreterOptions returns the interpreter options set by opts.
+func interpreterOptions(opts options) monkey.Options {
+	return monkey.Options{
+		Strict:            opts.strict,
+		CheckedArithmetic: opts.checked,
+		MaxCallDepth:      opts.maxDepth,
+		Engine:            opts.engine,
+		Optimize:          opts.optimize,
+		ModulePath:        filepath.SplitList(os.Getenv("MONKEY_PATH")),
+	}
+}
+
+// report writes the error a program failed with to stderr and returns the
+// exit status for it. When printResult is set the value of the program
+// is written to stdout, unless it is null.
+func report(
+	evaluated object.Object,
+	err error,
+	printResult bool,
+	stdout, stderr io.Writer,
+) int {
+	switch err := err.(type) {
+	case nil:
+	case *monkey.SyntaxError:
+		io.WriteString(stderr, err.Render())
+		return exitSyntaxError
+	case *monkey.RuntimeError:
+		fmt.Fprintln(stderr, err.Err.Inspect())
+		return exitRuntimeError
+	default:
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitRuntimeError
+	}
+
+	if printResult && evaluated != nil && evaluated.Type() != object.NULL_OBJ {
+		fmt.Fprintln(stdout, evaluated.Inspect())
+	}
+	return exitOK
+}
+
+func scriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func startRepl(opts options) {
 	usr, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", usr.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, interpreterOptions(opts))
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		argv   []string
+		code   int
+		stdout string
+		stderr string // contained in the error output, which is empty for ""
+	}{
+		{[]string{"-e", "1 + 2"}, exitOK, "3\n", ""},
+		{[]string{"-e", "let x = 1"}, exitOK, "", ""},
+		{[]string{"-e", "if (false) { 1 }"}, exitOK, "", ""},
+		{[]string{"-e", "args", "a", "b"}, exitOK, "[a, b]\n", ""},
+		{[]string{"-e", "len(args)"}, exitOK, "0\n", ""},
+		{[]string{"-e", "1 + true"}, exitRuntimeError, "", "-e:1:1: Error: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"-e", "let = 1"}, exitSyntaxError, "", "-e:1:5: error[P001]"},
+		{[]string{"--help"}, exitOK, usage, ""},
+		{[]string{"-e"}, exitUsage, "", "Usage:"},
+		{[]string{"run"}, exitUsage, "", "Usage:"},
+		{[]string{"run", "missing.mk"}, exitUsage, "", "monkey: open missing.mk"},
+		{[]string{"bogus"}, exitUsage, "", `monkey: unknown command "bogus"`},
+		{[]string{"--bogus", "-e", "1"}, exitUsage, "", "monkey: unknown option --bogus"},
+		{[]string{"--strict=yes", "-e", "1"}, exitUsage, "", "monkey: invalid option --strict=yes"},
+		{[]string{"--max-depth=0", "-e", "1"}, exitUsage, "", `monkey: invalid call depth "0"`},
+		{[]string{"--max-depth=1000000", "-e", "1"}, exitUsage, "", `monkey: invalid call depth "1000000" (at most 50000)`},
+		{[]string{"--engine=jit", "-e", "1"}, exitUsage, "", `monkey: unknown engine "jit"`},
+
+		{[]string{"--engine=vm", "-e", "[1, 2][1] + len(args)", "a"}, exitOK, "3\n", ""},
+		{[]string{"--engine=vm", "-e", "1 + true"}, exitRuntimeError, "", "-e:1:1: Error: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"--engine=eval", "-e", "fn(x) { x }"}, exitOK, "fn(x) {\nx\n}\n", ""},
+		{[]string{"--engine=vm", "-e", "fn(x) { x }"}, exitOK, "fn(x) {\nx\n}\n", ""},
+		{[]string{"--optimize", "-e", "if (1 > 2) { 1 } else { 2 * 3 }"}, exitOK, "6\n", ""},
+		{[]string{"--optimize", "--engine=vm", "-e", "if (false) { undefined }"}, exitRuntimeError, "", "identifier not found: undefined"},
+		{[]string{"--strict", "-e", "let a = 1; let a = 2"}, exitRuntimeError, "", "identifier already declared: a"},
+		{[]string{"--checked", "-e", "9223372036854775807 + 1"}, exitRuntimeError, "", "integer overflow"},
+		{[]string{"--max-depth=10", "-e", "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)"},
+			exitRuntimeError, "", "maximum recursion depth exceeded calling f (limit 10)"},
+		// The highest limit is reached before the Go stack overflows.
+		{[]string{"--max-depth=50000", "-e", "let f = fn(n) { let x = [1, {\"a\": [-(1 + f(n + 1))]}]; x }; f(0)"},
+			exitRuntimeError, "", "maximum recursion depth exceeded calling f (limit 50000)"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.argv, &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d (%s)", tt.argv, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.argv, tt.stdout, stdout.String())
+		}
+		if tt.stderr == "" && stderr.Len() != 0 || !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("wrong error output for %q. want=%q, got=%q", tt.argv, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	writeFile(t, script, `if (len(args) != 2 || !{"y": true}[args[1]]) { 1 + true }`)
+	bad := filepath.Join(dir, "bad.mk")
+	writeFile(t, bad, "let f = fn() {\n  1 / 0\n};\nf()")
+
+	tests := []struct {
+		argv   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"run", script, "x", "y"}, exitOK, ""},
+		{[]string{"run", script, "x"}, exitRuntimeError, "type mismatch"},
+		{[]string{"--engine=vm", "run", script, "x", "y"}, exitOK, ""},
+		{[]string{"run", bad}, exitRuntimeError, bad + ":2:3, in f"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.argv, &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d (%s)", tt.argv, tt.code, code, stderr.String())
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("script result printed for %q: %q", tt.argv, stdout.String())
+		}
+		if tt.stderr == "" && stderr.Len() != 0 || !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("wrong error output for %q. want=%q, got=%q", tt.argv, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	writeFile(t, script, `let n = len(args); if (n != 2) { 1 + true }`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", script}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build failed with %d: %s", code, stderr.String())
+	}
+	output := filepath.Join(dir, "out", "custom.mkc")
+	if err := os.Mkdir(filepath.Dir(output), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{"--optimize", "build", script, "-o", output}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build -o failed with %d: %s", code, stderr.String())
+	}
+
+	// Compiled scripts get their arguments and run on the virtual
+	// machine whatever the engine.
+	tests := []struct {
+		argv []string
+		code int
+	}{
+		{[]string{"run", filepath.Join(dir, "script.mkc"), "a", "b"}, exitOK},
+		{[]string{"run", output, "a", "b"}, exitOK},
+		{[]string{"--engine=eval", "run", output, "a", "b"}, exitOK},
+		{[]string{"run", output, "a"}, exitRuntimeError},
+	}
+
+	for _, tt := range tests {
+		stderr.Reset()
+		if code := run(tt.argv, &stdout, &stderr); code != tt.code {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d (%s)", tt.argv, tt.code, code, stderr.String())
+		}
+	}
+
+	errors := []struct {
+		source string
+		code   int
+		stderr string
+	}{
+		{"let = 1", exitSyntaxError, "error[P001]"},
+		{"let f = fn() { missing }", exitRuntimeError, "identifier not found: missing"},
+	}
+
+	for _, tt := range errors {
+		writeFile(t, script, tt.source)
+		stderr.Reset()
+		output := filepath.Join(dir, "failed.mkc")
+		if code := run([]string{"build", script, "-o", output}, &stdout, &stderr); code != tt.code {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d", tt.source, tt.code, code)
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("wrong error output for %q. want=%q, got=%q", tt.source, tt.stderr, stderr.String())
+		}
+		if _, err := os.Stat(output); err == nil {
+			t.Errorf("output written for %q", tt.source)
+		}
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.mkc")
+	writeFile(t, corrupt, "\x7fMKC")
+	stderr.Reset()
+	if code := run([]string{"run", corrupt}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("wrong exit code for corrupt bytecode. want=%d, got=%d", exitUsage, code)
+	}
+
+	usages := [][]string{
+		{"build"},
+		{"build", script, "-o"},
+		{"build", script, "other.mk"},
+		{"build", filepath.Join(dir, "missing.mk")},
+	}
+	for _, argv := range usages {
+		if code := run(argv, &stdout, &stderr); code != exitUsage {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d", argv, exitUsage, code)
+		}
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("build wrote to standard output: %q", stdout.String())
+	}
+}
+
+func TestRunBytecodeFromOtherDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.mk"), `import { value } from "./lib/value.mk"; if (value != 1) { 1 + true }`)
+	writeFile(t, filepath.Join(dir, "lib", "value.mk"), "export let value = 1;")
+
+	chdir(t, dir)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "main.mk", "-o", "out.mkc"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build failed with %d: %s", code, stderr.String())
+	}
+
+	// The compiled program imports relative to its script, not to the
+	// working directory.
+	chdir(t, t.TempDir())
+	if code := run([]string{"run", filepath.Join(dir, "out.mkc")}, &stdout, &stderr); code != exitOK {
+		t.Errorf("run failed with %d: %s", code, stderr.String())
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chdir changes the working directory until the end of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -0,0 +1,1466 @@
+package monkey
+
+import (
+	"math"
+	"playground/go-interpreter/src/object"
+	"strings"
+	"testing"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"5", 5},
+			{"10", 10},
+			{"-5", -5},
+			{"-10", -10},
+			{"5 + 5 + 5 + 5 - 10", 10},
+			{"2 * 2 * 2 * 2 * 2", 32},
+			{"-50 + 100 + -50", 0},
+			{"5 * 2 + 10", 20},
+			{"5 + 2 * 10", 25},
+			{"20 + 2 * -10", 0},
+			{"50 / 2 * 2 + 10", 60},
+			{"2 * (5 + 10)", 30},
+			{"3 * 3 * 3 + 10", 37},
+			{"3 * (3 * 3) + 10", 37},
+			{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+			{"10 % 3", 1},
+			{"-7 % 3", -1},
+			{"2 + 10 % 4 * 3", 8},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testIntegerObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"3.5", 3.5},
+			{"-2.5", -2.5},
+			{"1e3", 1000},
+			{"1.5 + 1.5", 3},
+			{"1 + 0.5", 1.5},
+			{"0.5 * 4", 2},
+			{"7 / 2.0", 3.5},
+			{"10 - 2.5 * 2", 5},
+			{"float(3) / 2", 1.5},
+			{"float(\"2.25\")", 2.25},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testFloatObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestNumberConversions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"int(3.99)", 3},
+			{"int(-3.99)", -3},
+			{"int(7)", 7},
+			{`int("42")`, 42},
+			{`int("4x")`, `could not parse "4x" as integer`},
+			{"int(1e300)", "cannot convert 1e+300 to INTEGER"},
+			{"int(true)", "argument to `int` not supported, got BOOLEAN"},
+			{`float("x")`, `could not parse "x" as float`},
+			{"float(1, 2)", "wrong number of arguments. got=2, want=1"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			}
+		}
+	})
+}
+
+func TestFloatInspect(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"3.0", "3.0"},
+			{"0.1 + 0.2", "0.30000000000000004"},
+			{"1e21", "1e+21"},
+			{"1.0 / 0", "+Inf"},
+		}
+
+		for _, tt := range tests {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("wrong inspect output for %q. expected=%q, got=%q",
+					tt.input, tt.expected, got)
+			}
+		}
+	})
+}
+
+func TestFunctionInspect(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"fn() { 1 }", "fn() {\n1\n}"},
+			{"fn(x, y = 2, ...rest) { x + y }", "fn(x, y = 2, ...rest) {\n(x + y)\n}"},
+			{"let add = fn(a) { fn(b) { a + b } }; add(1)", "fn(b) {\n(a + b)\n}"},
+		}
+
+		for _, tt := range tests {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("wrong inspect output for %q. expected=%q, got=%q",
+					tt.input, tt.expected, got)
+			}
+		}
+	})
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"true", true},
+			{"false", false},
+			{"1 < 2", true},
+			{"1 > 2", false},
+			{"1 < 1", false},
+			{"1 > 1", false},
+			{"1 == 1", true},
+			{"1 != 1", false},
+			{"1 == 2", false},
+			{"1 != 2", true},
+			{"true == true", true},
+			{"false == false", true},
+			{"true == false", false},
+			{"true != false", true},
+			{"false != true", true},
+			{"(1 < 2) == true", true},
+			{"(1 < 2) == false", false},
+			{"(1 > 2) == true", false},
+			{"(1 > 2) == false", true},
+			{"1.5 < 2", true},
+			{"2 > 2.5", false},
+			{"2 == 2.0", true},
+			{"2.5 != 2.5", false},
+			{"1 <= 2", true},
+			{"2 <= 2", true},
+			{"3 <= 2", false},
+			{"1 >= 2", false},
+			{"2 >= 2", true},
+			{"2.5 >= 2", true},
+			{"true && true", true},
+			{"true && false", false},
+			{"false || true", true},
+			{"false || false", false},
+			{"1 && \"x\"", true},
+			{"1 < 2 && 2 < 3 || false", true},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestShortCircuitEvaluation(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"false && (1 / 0)", false},
+			{"true || (1 / 0)", true},
+			{"false && (1 + true)", false},
+			{"let f = fn() { 1 + true }; true || f()", true},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected)
+		}
+
+		evaluated := testEval("true && undefined")
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+		if errObj.Message != "identifier not found: undefined" {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+	})
+}
+
+func TestBangOperator(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"!true", false},
+			{"!false", true},
+			{"!5", false},
+			{"!!true", true},
+			{"!!false", false},
+			{"!!5", true},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"if (true) { 10 }", 10},
+			{"if (false) { 10 }", nil},
+			{"if (1) { 10 }", 10},
+			{"if (1 < 2) { 10 }", 10},
+			{"if (1 > 2) { 10 }", nil},
+			{"if (1 > 2) { 10 } else { 20 }", 20},
+			{"if (1 < 2) { 10 } else { 20 }", 10},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	})
+}
+
+func TestReturnStatements(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"return 10;", 10},
+			{"return 10; 9;", 10},
+			{"return 2 * 5; 9;", 10},
+			{"9; return 2 * 5; 9;", 10},
+			{"if (10 > 1) { return 10; }", 10},
+			{
+				`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+				10,
+			},
+			{
+				`
+let f = fn(x) {
+  return x;
+  x + 10;
+};
+f(10);`,
+				10,
+			},
+			{
+				`
+let f = fn(x) {
+   let result = x + 10;
+   return result;
+   return 10;
+};
+f(10);`,
+				20,
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testIntegerObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestErrorHandling(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{
+				"5 + true;",
+				"type mismatch: INTEGER + BOOLEAN",
+			},
+			{
+				"5 + true; 5;",
+				"type mismatch: INTEGER + BOOLEAN",
+			},
+			{
+				"-true",
+				"unknown operator: -BOOLEAN",
+			},
+			{
+				"true + false;",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"true + false + true + false;",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"5; true + false; 5",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				`"Hello" - "World"`,
+				"unknown operator: STRING - STRING",
+			},
+			{
+				"if (10 > 1) { true + false; }",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"foobar",
+				"identifier not found: foobar",
+			},
+			{
+				`{"name": "Monkey"}[fn(x) { x }];`,
+				"unusable as hash key: FUNCTION",
+			},
+			{
+				`999[1]`,
+				"index operator not supported: INTEGER",
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errObj.Message)
+			}
+		}
+	})
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `let inner = fn(x) {
+  x + true;
+};
+let outer = fn(x) {
+  inner(x) * 2;
+};
+let run = fn() { let result = outer(1); result };
+run();`
+
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+
+		if errObj.Pos.Line != 2 || errObj.Pos.Column != 3 {
+			t.Errorf("wrong error position. got=%s", errObj.Pos)
+		}
+
+		expectedStack := []struct {
+			function string
+			line     int
+		}{
+			{"inner", 5},
+			{"outer", 7},
+			{"run", 8},
+		}
+
+		if len(errObj.Stack) != len(expectedStack) {
+			t.Fatalf("wrong stack depth. want=%d, got=%d",
+				len(expectedStack), len(errObj.Stack))
+		}
+
+		for i, expected := range expectedStack {
+			frame := errObj.Stack[i]
+			if frame.Function != expected.function || frame.CallSite.Line != expected.line {
+				t.Errorf("wrong frame %d. want=%s called at line %d, got=%s called at %s",
+					i, expected.function, expected.line, frame.Function, frame.CallSite)
+			}
+		}
+
+		expectedTrace := `Traceback (most recent call last):
+  8:1, in <main>
+  7:31, in run
+  5:3, in outer
+  2:3, in inner
+Error: type mismatch: INTEGER + BOOLEAN`
+
+		if errObj.Inspect() != expectedTrace {
+			t.Errorf("wrong traceback. expected=\n%s\ngot=\n%s", expectedTrace, errObj.Inspect())
+		}
+	})
+}
+
+func TestTailCallTraceback(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `let a = fn() { b() };
+let b = fn() { c() };
+let c = fn() { 1 / 0 };
+a()`
+
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+
+		expectedTrace := `Traceback (most recent call last):
+  4:1, in <main>
+  [2 tail calls elided]
+  3:16, in c
+Error: division by zero: 1 / 0`
+
+		if errObj.Inspect() != expectedTrace {
+			t.Errorf("wrong traceback. expected=\n%s\ngot=\n%s", expectedTrace, errObj.Inspect())
+		}
+	})
+}
+
+func TestTryCatch(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`try { 1 } catch (e) { 2 }`, 1},
+			{`try { throw "bad"; 1 } catch (e) { 2 }`, 2},
+			{`try { throw "bad" } catch (e) { e["message"] }`, "bad"},
+			{`try { throw 42 } catch (e) { e["value"] + 1 }`, 43},
+			{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+			{`try { 1 + true } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+			{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+			{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero: 1 / 0"},
+			{"try {\n  throw \"x\"\n} catch (e) { e[\"position\"] }", "2:3"},
+			{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e["stack"] }`,
+				[]string{"f (1:47)", "g (1:64)"}},
+			{`try { throw {"message": "custom", "code": 7} } catch (e) { e["value"]["code"] }`, 7},
+			{`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e["message"] }`, "inner"},
+			{`let log = []; try { log = push(log, 1) } finally { log = push(log, 2) }; log`, []string{"1", "2"}},
+			{`let log = []; try { throw "x" } catch (e) { log = push(log, 1) } finally { log = push(log, 2) }; log`, []string{"1", "2"}},
+			{`let log = []; try { try { throw "x" } finally { log = push(log, 1) } } catch (e) { log = push(log, e["message"]) }; log`, []string{"1", "x"}},
+			{`try { throw "a" } finally { 1 }`, "error: a"},
+			{`try { throw "a" } catch (e) { throw "b" }`, "error: b"},
+			{`try { 1 } finally { throw "c" }`, "error: c"},
+			{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+			{`let f = fn() { try { return g() } catch (e) { "caught " + e["message"] } }; let g = fn() { throw "g" }; f()`, "caught g"},
+			{`let f = fn(n) { try { if (n == 0) { throw "zero" }; return f(n - 1) } catch (e) { n } }; f(3)`, 0},
+			{`let i = 0; while (true) { try { i += 1; if (i > 20) { break } } finally { i += 10 } }; i`, 33},
+			{`const e = 1; try { throw "x" } catch (e) { 2 }`, "error: cannot assign to constant: e"},
+			{`throw "uncaught"`, "error: uncaught"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case []string:
+				arr, ok := evaluated.(*object.Array)
+				if !ok {
+					t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if len(arr.Elements) != len(expected) {
+					t.Errorf("wrong number of elements. want=%d, got=%s", len(expected), arr.Inspect())
+					continue
+				}
+				for i, el := range arr.Elements {
+					str := el.Inspect()
+					if s, ok := el.(*object.String); ok {
+						str = s.Value
+					}
+					if str != expected[i] {
+						t.Errorf("element %d wrong. want=%q, got=%q", i, expected[i], str)
+					}
+				}
+			case string:
+				if msg, ok := strings.CutPrefix(expected, "error: "); ok {
+					errObj, isErr := evaluated.(*object.Error)
+					if !isErr {
+						t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+					} else if errObj.Message != msg {
+						t.Errorf("wrong error message. expected=%q, got=%q", msg, errObj.Message)
+					}
+					continue
+				}
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+				}
+			}
+		}
+	})
+}
+
+func TestAssignExpressions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let a = 1; a = 2; a", 2},
+			{"let a = 1; let b = a = 5; a + b", 10},
+			{"let a = 1; let b = 2; a = b = 3; a * b", 9},
+			{"let a = 10; a += 5; a -= 3; a *= 2; a /= 4; a %= 4", 2},
+			{"let a = 1.5; a += 1; a", 2.5},
+			{`let s = "a"; s += "b"; s`, "ab"},
+			{"let i = 0; while (i < 5) { i += 1 }; i", 5},
+			{"let counter = fn() { let c = 0; fn() { c += 1 } }(); counter(); counter(); counter()", 3},
+			{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+			{"let arr = [1, 2, 3]; arr[1] = 20; arr[1]", 20},
+			{"let arr = [1, 2, 3]; arr[2] += 10; arr[2]", 13},
+			{"let arr = [1, 2, 3]; let alias = arr; alias[0] = 9; arr[0]", 9},
+			{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h["a"] + h["b"]`, 13},
+			{"let m = [[1, 2], [3, 4]]; m[1][0] = 7; m[1][0]", 7},
+			{"x = 5", "assignment to undeclared identifier: x"},
+			{"x += 5", "identifier not found: x"},
+			{"let a = 1; a += true", "type mismatch: INTEGER + BOOLEAN"},
+			{"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+			{`let arr = [1]; arr["a"] = 2`, "array index must be INTEGER, got STRING"},
+			{`let h = {}; h[fn() {}] = 2`, "unusable as hash key: FUNCTION"},
+			{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case float64:
+				testFloatObject(t, evaluated, expected)
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					if errObj.Message != expected {
+						t.Errorf("wrong error message. expected=%q, got=%q",
+							expected, errObj.Message)
+					}
+					continue
+				}
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+				}
+			}
+		}
+	})
+}
+
+func TestConstStatements(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"const a = 5; a", 5},
+			{"const a = 5; let f = fn() { let a = 10; a = 11; a }; f() + a", 16},
+			{"const a = 5; let f = fn() { const a = 1; a }; f() + a", 6},
+			{"let a = 1; const a = 2; a", 2},
+			{"const a = 5; a = 6", "cannot assign to constant: a"},
+			{"const a = 5; a += 1", "cannot assign to constant: a"},
+			{"const a = 5; let f = fn() { a = 6 }; f()", "cannot assign to constant: a"},
+			{"const a = 5; let a = 6", "cannot redeclare constant: a"},
+			{"const a = 5; const a = 6", "cannot redeclare constant: a"},
+			{"const x = 0; for (x in [1, 2]) { }", "cannot assign to constant: x"},
+			{"const arr = [1, 2]; arr[0] = 3; arr[0]", 3},
+			// A declaration in a loop body runs again on every iteration.
+			{"let i = 0; while (i < 3) { const y = i; i += 1 }; i", 3},
+			{"let s = 0; for (x in [1, 2, 3]) { const d = x * 2; s += d }; s", 12},
+			{"let f = fn() { let s = 0; for (x in [1, 2]) { const d = x; s += d }; s }; f()", 3},
+			{"for (x in [1, 2]) { const d = x; const d = 0 }", "cannot redeclare constant: d"},
+			{"const d = 0; for (x in [1, 2]) { const d = x }", "cannot redeclare constant: d"},
+			// Only assignments and declarations that run fail.
+			{"let f = fn() { const k = 2; let g = fn() { k = 3 }; k }; f()", 2},
+			{"const a = 1; if (false) { a = 2 }; a", 1},
+			{"const a = 5; let r = try { a = 6 } catch (e) { 1 }; r + a", 6},
+			{"const e = 0; try { throw 1 } catch (e) { 2 }", "cannot assign to constant: e"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			}
+		}
+	})
+}
+
+func TestStrictMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; let a = 2", "identifier already declared: a"},
+		{"let a = 1; const a = 2", "identifier already declared: a"},
+		{"let f = fn() { let b = 1; let b = 2 }; f()", "identifier already declared: b"},
+		{"let a = 1; let f = fn() { let a = 2; a }; f()", ""},
+		{"let a = 1; a = 2; a", ""},
+		{"let i = 0; while (i < 3) { let y = i; i += 1 }; i", ""},
+		{"let f = fn() { for (x in [1, 2]) { let y = x } }; f()", ""},
+		{"for (x in [1, 2]) { let y = x; let y = 0 }", "identifier already declared: y"},
+		{"let y = 0; for (x in [1, 2]) { let y = x }", "identifier already declared: y"},
+		{"let a = 1; if (false) { let a = 2 }; a", ""},
+	}
+
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			for _, tt := range tests {
+				evaluated := runOn(Options{Engine: e.engine, Strict: true}, tt.input)
+				errObj, isErr := evaluated.(*object.Error)
+				if tt.expected == "" {
+					if isErr {
+						t.Errorf("unexpected error for %q: %s", tt.input, errObj.Message)
+					}
+					continue
+				}
+				if !isErr {
+					t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != tt.expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input     string
+		wrapped   int64
+		overflows bool
+	}{
+		{"9223372036854775807 + 1", math.MinInt64, true},
+		{"-9223372036854775807 - 2", math.MaxInt64, true},
+		{"4611686018427387904 * 2", math.MinInt64, true},
+		{"-1 * (-9223372036854775807 - 1)", math.MinInt64, true},
+		{"(-9223372036854775807 - 1) / -1", math.MinInt64, true},
+		{"-(-9223372036854775807 - 1)", math.MinInt64, true},
+		{"let x = 9223372036854775807; x += 1", math.MinInt64, true},
+		{"9223372036854775806 + 1", math.MaxInt64, false},
+		{"-9223372036854775807 - 1", math.MinInt64, false},
+		{"3037000499 * 3037000499", 9223372030926249001, false},
+		{"(-9223372036854775807 - 1) % -1", 0, false},
+	}
+
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			for _, tt := range tests {
+				testIntegerObject(t, runOn(Options{Engine: e.engine}, tt.input), tt.wrapped)
+
+				evaluated := runOn(Options{Engine: e.engine, CheckedArithmetic: true}, tt.input)
+				errObj, isErr := evaluated.(*object.Error)
+				if isErr != tt.overflows {
+					t.Errorf("checked %q: overflow expected=%t, got=%T(%+v)",
+						tt.input, tt.overflows, evaluated, evaluated)
+					continue
+				}
+				if isErr && !strings.HasPrefix(errObj.Message, "integer overflow: ") {
+					t.Errorf("wrong error message. got=%q", errObj.Message)
+				}
+				if !isErr {
+					testIntegerObject(t, evaluated, tt.wrapped)
+				}
+			}
+		})
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"1 / 0", "division by zero: 1 / 0"},
+			{"10 % 0", "division by zero: 10 % 0"},
+			{"let x = 0; 5 / x", "division by zero: 5 / 0"},
+			{"let x = 5; x /= 0", "division by zero: 5 / 0"},
+			{"let x = 5; x %= 0", "division by zero: 5 % 0"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		}
+	})
+}
+
+func TestLoops(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let i = 0; while (i < 10) { let i = i + 1; }; i", 10},
+			{"while (false) { 1 }", nil},
+			{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", 6},
+			{"let s = 0; for (i, x in [5, 6, 7]) { let s = s + i * x; }; s", 20},
+			{`let s = 0; for (k in {"a": 1, "b": 2}) { let s = s + len(k); }; s`, 2},
+			{`let s = 0; for (k, v in {"a": 1, "b": 2}) { let s = s + v; }; s`, 3},
+			{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+			{"let n = 0; while (true) { let n = n + 1; if (n == 5) { break; } }; n", 5},
+			{"let s = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue; } let s = s + x; }; s", 4},
+			{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } 0 }; f()", 20},
+			{"let s = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break } let s = s + x * y; } }; s", 30},
+			{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+			{"for (x in [1]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case nil:
+				testNullObject(t, evaluated)
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					if errObj.Message != expected {
+						t.Errorf("wrong error message. expected=%q, got=%q",
+							expected, errObj.Message)
+					}
+					continue
+				}
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+				}
+			}
+		}
+	})
+}
+
+func TestLoopOverLargeArray(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `
+let build = fn(n) {
+  let arr = [];
+  let i = 0;
+  while (i < n) { let arr = push(arr, i); let i = i + 1; }
+  arr
+};
+let s = 0;
+for (x in build(5000)) { let s = s + x; }
+s`
+
+		testIntegerObject(t, testEval(input), 12497500)
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)", 100000},
+			{"let count = fn(n) { if (n == 0) { return 0; }; return count(n - 1); }; count(100000)", 0},
+			{"let count = fn(n) { return if (n > 0) { count(n - 1) } else { n } }; count(100000)", 0},
+			{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+even(100001)`, false},
+			{"let f = fn(n) { while (true) { return if (n == 0) { 42 } else { f(n - 1) } } }; f(100000)", 42},
+			{"let f = fn(n) { if (n == 0) { return 1 }; 1 + f(n - 1) }; f(10001)", "maximum recursion depth exceeded calling f (limit 10000)"},
+			{"let f = fn(n) { if (n == 0) { len(1) } else { f(n - 1) } }; f(100000)", "argument to `len` not supported, got INTEGER"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+			}
+		}
+	})
+}
+
+func TestListProcessingWithTailCalls(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `
+let map = fn(arr, f) {
+  let iter = fn(arr, accumulated) {
+    if (len(arr) == 0) { accumulated } else { iter(rest(arr), push(accumulated, f(first(arr)))) }
+  };
+  iter(arr, []);
+};
+let reduce = fn(arr, initial, f) {
+  let iter = fn(arr, result) {
+    if (len(arr) == 0) { result } else { iter(rest(arr), f(result, first(arr))) }
+  };
+  iter(arr, initial);
+};
+let range = fn(n, acc) { if (len(acc) == n) { acc } else { range(n, push(acc, len(acc) + 1)) } };
+let xs = range(100000, []);
+let doubled = map(xs, fn(x) { x * 2 });
+doubled[0] = 0;
+reduce(doubled, 0, fn(a, b) { a + b }) + xs[0];
+`
+
+		testIntegerObject(t, testEval(input), 10000100000-2+1)
+	})
+}
+
+func TestLetStatements(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"let a = 5; a;", 5},
+			{"let a = 5 * 5; a;", 25},
+			{"let a = 5; let b = a; b;", 5},
+			{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		}
+
+		for _, tt := range tests {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestFunctionApplication(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"let identity = fn(x) { x; }; identity(5);", 5},
+			{"let identity = fn(x) { return x; }; identity(5);", 5},
+			{"let double = fn(x) { x * 2; }; double(5);", 10},
+			{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+			{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+			{"fn(x) { x; }(5)", 5},
+		}
+
+		for _, tt := range tests {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestFunctionsWithoutValue(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []string{
+			"let f = fn() {}; f()",
+			"fn() {}()",
+			"let f = fn() {}; puts(f())",
+			"let f = fn() { let a = 1; }; f()",
+			"let f = fn(x) { if (x) { 1 } }; f(false)",
+			"let f = fn() { while (false) {} }; f()",
+			"let f = fn() {}; let g = fn() { f() }; g()",
+		}
+
+		for _, input := range tests {
+			evaluated := testEval(input)
+			if !testNullObject(t, evaluated) {
+				t.Errorf("wrong result for %q", input)
+			}
+		}
+	})
+}
+
+func TestFunctionArity(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let add = fn(a, b) { a + b }; add(1)", "wrong number of arguments to add: want=2, got=1"},
+			{"let add = fn(a, b) { a + b }; add(1, 2, 3)", "wrong number of arguments to add: want=2, got=3"},
+			{"fn() { 1 }(1)", "wrong number of arguments to <anonymous>: want=0, got=1"},
+			{"let f = fn(a, b = 2) { a + b }; f()", "wrong number of arguments to f: want=1 to 2, got=0"},
+			{"let f = fn(a, ...rest) { a }; f()", "wrong number of arguments to f: want=at least 1, got=0"},
+			{"let f = fn(a, b = 2) { a + b }; f(1)", 3},
+			{"let f = fn(a, b = 2) { a + b }; f(1, 5)", 6},
+			{"let f = fn(a, b = a * 10) { a + b }; f(2)", 22},
+			{"let x = 100; let f = fn(a = x) { a }; let x = 1; f()", 1},
+			{"let f = fn(a, b = c) { a }; f(1)", "identifier not found: c"},
+			{"let f = fn(first, ...rest) { len(rest) }; f(1)", 0},
+			{"let f = fn(first, ...rest) { len(rest) }; f(1, 2, 3)", 2},
+			{"let f = fn(first, ...rest) { rest[1] }; f(1, 2, 3)", 3},
+			{"let f = fn(a, b = 10, ...rest) { a + b + len(rest) }; f(1)", 11},
+			{"let f = fn(a, b = 10, ...rest) { a + b + len(rest) }; f(1, 2, 3, 4)", 5},
+			{"let sum = fn(...xs) { let s = 0; for (x in xs) { s += x }; s }; sum(1, 2, 3, 4)", 10},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			}
+		}
+	})
+}
+
+func TestEnclosingEnvironments(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `
+let first = 10;
+let second = 10;
+let third = 10;
+
+let ourFunction = fn(first) {
+  let second = 20;
+
+  first + second + third;
+};
+
+ourFunction(20) + first + second;`
+
+		testIntegerObject(t, testEval(input), 70)
+	})
+}
+
+func TestClosures(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+		testIntegerObject(t, testEval(input), 4)
+
+		// A closure refers to the variables declared before it, even when it
+		// runs after a variable of the same name is declared.
+		input = `
+let x = "global";
+let f = fn() {
+  let g = fn() { x };
+  let r = g();
+  let x = "local";
+  r
+};
+f()`
+
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != "global" {
+			t.Errorf("closure bound to the wrong variable. got=%q", str.Value)
+		}
+	})
+}
+
+func TestStringLiteral(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `"Hello World!"`
+
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != "Hello World!" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
+}
+
+func TestStringConcatenation(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `"Hello" + " " + "World!"`
+
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != "Hello World!" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`len("")`, 0},
+			{`len("four")`, 4},
+			{`len("hello world")`, 11},
+			{`len(1)`, "argument to `len` not supported, got INTEGER"},
+			{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+			{`len([1, 2, 3])`, 3},
+			{`len([])`, 0},
+			{`puts("hello", "world!")`, nil},
+			{`first([1, 2, 3])`, 1},
+			{`first([])`, nil},
+			{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+			{`last([1, 2, 3])`, 3},
+			{`last([])`, nil},
+			{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+			{`rest([1, 2, 3])`, []int{2, 3}},
+			{`rest([])`, nil},
+			{`push([], 1)`, []int{1}},
+			{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case nil:
+				testNullObject(t, evaluated)
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("object is not Error. got=%T (%+v)",
+						evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			case []int:
+				array, ok := evaluated.(*object.Array)
+				if !ok {
+					t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+
+				if len(array.Elements) != len(expected) {
+					t.Errorf("wrong num of elements. want=%d, got=%d",
+						len(expected), len(array.Elements))
+					continue
+				}
+
+				for i, expectedElem := range expected {
+					testIntegerObject(t, array.Elements[i], int64(expectedElem))
+				}
+			}
+		}
+	})
+}
+
+func TestArrayLiterals(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := "[1, 2 * 2, 3 + 3]"
+
+		evaluated := testEval(input)
+		result, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if len(result.Elements) != 3 {
+			t.Fatalf("array has wrong num of elements. got=%d",
+				len(result.Elements))
+		}
+
+		testIntegerObject(t, result.Elements[0], 1)
+		testIntegerObject(t, result.Elements[1], 4)
+		testIntegerObject(t, result.Elements[2], 6)
+	})
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				"[1, 2, 3][0]",
+				1,
+			},
+			{
+				"[1, 2, 3][1]",
+				2,
+			},
+			{
+				"[1, 2, 3][2]",
+				3,
+			},
+			{
+				"let i = 0; [1][i];",
+				1,
+			},
+			{
+				"[1, 2, 3][1 + 1];",
+				3,
+			},
+			{
+				"let myArray = [1, 2, 3]; myArray[2];",
+				3,
+			},
+			{
+				"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+				6,
+			},
+			{
+				"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+				2,
+			},
+			{
+				"[1, 2, 3][3]",
+				nil,
+			},
+			{
+				"[1, 2, 3][-1]",
+				nil,
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	})
+}
+
+func TestHashLiterals(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+		evaluated := testEval(input)
+		result, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Fatalf("program didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		expected := []struct {
+			key   object.Hashable
+			value int64
+		}{
+			{&object.String{Value: "one"}, 1},
+			{&object.String{Value: "two"}, 2},
+			{&object.String{Value: "three"}, 3},
+			{&object.Integer{Value: 4}, 4},
+			{object.TRUE, 5},
+			{object.FALSE, 6},
+		}
+
+		if result.Len() != len(expected) {
+			t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+		}
+
+		for i, pair := range result.Pairs() {
+			if pair.Key.Inspect() != expected[i].key.Inspect() {
+				t.Errorf("pair %d has wrong key. want=%s, got=%s",
+					i, expected[i].key.Inspect(), pair.Key.Inspect())
+			}
+
+			value, ok := result.Get(expected[i].key)
+			if !ok {
+				t.Errorf("no pair for key %s", expected[i].key.Inspect())
+				continue
+			}
+			testIntegerObject(t, value, expected[i].value)
+		}
+	})
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`{"b": 1, "a": 2, "c": 3}`, `{b: 1, a: 2, c: 3}`},
+			{`let h = {"b": 1, "a": 2}; h["z"] = 3; h["b"] = 4; h`, `{b: 4, a: 2, z: 3}`},
+			{`{1: "x", "1": "y", 1: "z"}`, `{1: z, 1: y}`},
+			{`let keys = []; for (k in {"q": 1, "w": 2, "e": 3, "r": 4}) { keys = push(keys, k) }; keys`,
+				`[q, w, e, r]`},
+			{`let log = []; let note = fn(x) { log = push(log, x); x };
+{note("k1"): note(1), note("k2"): note(2)}; log`, `[k1, 1, k2, 2]`},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	})
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval func(string) object.Object) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				`{"foo": 5}["foo"]`,
+				5,
+			},
+			{
+				`{"foo": 5}["bar"]`,
+				nil,
+			},
+			{
+				`let key = "foo"; {"foo": 5}[key]`,
+				5,
+			},
+			{
+				`{}["foo"]`,
+				nil,
+			},
+			{
+				`{5: 5}[5]`,
+				5,
+			},
+			{
+				`{true: 5}[true]`,
+				5,
+			},
+			{
+				`{false: 5}[false]`,
+				5,
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	})
+}
+
+// engines are the engines the tests run programs on.
+var engines = []struct {
+	name   string
+	engine Engine
+}{
+	{"eval", Evaluator},
+	{"vm", VM},
+}
+
+// forEachEngine runs test as a subtest on every engine, with testEval
+// running a program on the engine and returning its value or the error it
+// failed with.
+func forEachEngine(t *testing.T, test func(t *testing.T, testEval func(string) object.Object)) {
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			test(t, func(input string) object.Object {
+				return runOn(Options{Engine: e.engine}, input)
+			})
+		})
+	}
+}
+
+// runOn runs input on a new interpreter created with opts, returning the
+// value of the program or the error it failed with.
+func runOn(opts Options, input string) object.Object {
+	result, err := New(opts).Run("", input)
+	switch err := err.(type) {
+	case nil:
+		return result
+	case *RuntimeError:
+		return err.Err
+	default:
+		return &object.Error{Message: err.Error()}
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != object.NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package monkey
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/object"
+	"strings"
+)
+
+// loader imports the modules of an Interpreter and of the modules it
+// imports in turn. Each file runs once, in an interpreter of its own, and
+// every later import of it gets the same module.
+type loader struct {
+	opts    Options
+	modules map[string]*object.Module // by absolute path
+	// loading holds the files being run, outermost first, as an import
+	// of any of them would never finish.
+	loading []string
+}
+
+func newLoader(opts Options) *loader {
+	return &loader{opts: opts, modules: make(map[string]*object.Module)}
+}
+
+// Import returns the module at path, imported by the file from. Errors
+// raised by the module are returned as the *object.Error they are, so
+// that they keep their location in the module.
+func (l *loader) Import(path, from string) (*object.Module, error) {
+	file, err := l.resolve(path, from)
+	if err != nil {
+		return nil, err
+	}
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if module, ok := l.modules[key]; ok {
+		return module, nil
+	}
+	for i, loading := range l.loading {
+		if loading == key {
+			return nil, l.cycleError(i, file)
+		}
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %s: %w", path, err)
+	}
+
+	l.loading = append(l.loading, key)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	module, err := l.run(file, string(source))
+	if err != nil {
+		return nil, err
+	}
+	l.modules[key] = module
+	return module, nil
+}
+
+// enter marks file, which an interpreter runs itself, as loading until
+// the returned function is called, so that the modules it imports cannot
+// run it again. Names that are not files, such as that of a program given
+// with -e, are ignored.
+func (l *loader) enter(file string) func() {
+	if l == nil {
+		return func() {}
+	}
+	if info, err := os.Stat(file); err != nil || info.IsDir() {
+		return func() {}
+	}
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return func() {}
+	}
+	l.loading = append(l.loading, key)
+	return func() { l.loading = l.loading[:len(l.loading)-1] }
+}
+
+// resolve finds the file path refers to. A path starting with ./ or ../
+// is relative to the directory of the importing file; another relative
+// path is looked up there first and then in each directory of the module
+// path.
+func (l *loader) resolve(path, from string) (string, error) {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	// Programs that are not read from a file, such as those given with
+	// -e, import relative to the working directory.
+	dir := filepath.Dir(from)
+	candidates := []string{filepath.Join(dir, path)}
+	if !strings.HasPrefix(path, "."+string(filepath.Separator)) &&
+		!strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		for _, dir := range l.opts.ModulePath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, file := range candidates {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", filepath.ToSlash(path))
+}
+
+// cycleError reports that file, which is loading[i], imports itself
+// through the files loaded after it.
+func (l *loader) cycleError(i int, file string) error {
+	names := []string{}
+	for _, key := range l.loading[i:] {
+		names = append(names, l.displayName(key))
+	}
+	names = append(names, l.displayName(l.loading[i]))
+	return fmt.Errorf("import cycle: %s", strings.Join(names, " -> "))
+}
+
+// displayName returns the path of the absolute file key relative to the
+// working directory when it is inside it.
+func (l *loader) displayName(key string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, key); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(key)
+}
+
+// run runs the module in file and collects its exports, which are the
+// values of the exported variables once the file has run.
+func (l *loader) run(file, source string) (*object.Module, error) {
+	program, err := parse(file, source)
+	if err != nil {
+		return nil, err
+	}
+
+	in := newInterpreter(l.opts, l)
+	if _, err := in.exec(program); err != nil {
+		if err, ok := err.(*RuntimeError); ok {
+			return nil, err.Err
+		}
+		return nil, err
+	}
+
+	module := &object.Module{Path: filepath.ToSlash(file), Exports: make(map[string]object.Object)}
+	for _, s := range program.Statements {
+		if export, ok := s.(*ast.ExportStatement); ok {
+			name := export.Statement.Name.Value
+			if val, ok := in.Lookup(name); ok {
+				module.Exports[name] = val
+			}
+		}
+	}
+	return module, nil
+}
@@ -0,0 +1,347 @@
+// Package monkey is the API for embedding the Monkey interpreter in Go
+// programs. An Interpreter keeps its global environment between runs, so
+// a host can define values and functions once and run several programs
+// against them.
+package monkey
+
+import (
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/compiler"
+	"playground/go-interpreter/src/evaluator"
+	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/optimizer"
+	"playground/go-interpreter/src/parser"
+	"playground/go-interpreter/src/resolver"
+	"playground/go-interpreter/src/vm"
+	"sort"
+	"strings"
+)
+
+// Engine selects how an Interpreter executes programs.
+type Engine int
+
+const (
+	// Evaluator walks the syntax tree of the program.
+	Evaluator Engine = iota
+	// VM compiles the program to bytecode and runs it on a virtual
+	// machine.
+	VM
+)
+
+// Options configures an Interpreter.
+type Options struct {
+	// Strict rejects declaring a name twice in the same scope.
+	Strict bool
+	// CheckedArithmetic makes integer overflow a runtime error.
+	CheckedArithmetic bool
+	// MaxCallDepth limits the nesting of function calls. Zero means
+	// object.DefaultMaxCallDepth, and the evaluator takes at most
+	// object.MaxCallDepthLimit.
+	MaxCallDepth int
+	// Engine is the engine programs run on.
+	Engine Engine
+	// Optimize folds constants and removes dead code from programs
+	// before they run.
+	Optimize bool
+	// Incremental makes the programs run by the interpreter parts of one
+	// session, as the inputs of the REPL are: functions can refer to
+	// globals declared by later programs.
+	Incremental bool
+	// ModulePath lists the directories searched for imported modules
+	// whose path does not start with ./ or ../, after the directory of
+	// the importing file.
+	ModulePath []string
+}
+
+type Interpreter struct {
+	opts   Options
+	env    *object.Environment
+	loader *loader
+	// vmLoader imports the modules of compiled programs run by an
+	// interpreter using the evaluator, which need to run on the VM too.
+	vmLoader *loader
+
+	// The state the VM engine keeps between runs.
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func New(opts Options) *Interpreter {
+	return newInterpreter(opts, newLoader(opts))
+}
+
+// newInterpreter creates an interpreter importing modules with loader,
+// which the modules it imports share.
+func newInterpreter(opts Options, loader *loader) *Interpreter {
+	if opts.Engine == VM {
+		return &Interpreter{
+			opts:        opts,
+			loader:      loader,
+			symbolTable: newSymbolTable(),
+			globals:     make([]object.Object, vm.GlobalsSize),
+		}
+	}
+
+	env := object.NewEnvironment()
+	env.SetStrict(opts.Strict)
+	env.SetCheckedArithmetic(opts.CheckedArithmetic)
+	env.SetIncremental(opts.Incremental)
+	if opts.MaxCallDepth > 0 {
+		env.SetMaxCallDepth(opts.MaxCallDepth)
+	}
+	env.SetImporter(loader)
+	return &Interpreter{opts: opts, env: env, loader: loader}
+}
+
+// Define binds name to val in the global environment.
+func (in *Interpreter) Define(name string, val object.Object) {
+	if in.env == nil {
+		symbol := in.symbolTable.Define(name)
+		in.globals[symbol.Index] = val
+		return
+	}
+	in.env.Set(name, val)
+}
+
+// DefineFunc makes fn callable from Monkey code as name.
+func (in *Interpreter) DefineFunc(name string, fn object.BuiltinFunction) {
+	in.Define(name, &object.Builtin{Fn: fn})
+}
+
+// Lookup returns the value bound to name in the global environment.
+func (in *Interpreter) Lookup(name string) (object.Object, bool) {
+	if in.env == nil {
+		symbol, ok := in.symbolTable.Resolve(name)
+		if !ok || symbol.Scope != compiler.GlobalScope || in.globals[symbol.Index] == nil {
+			return nil, false
+		}
+		return in.globals[symbol.Index], true
+	}
+	return in.env.Get(name)
+}
+
+// Run parses and evaluates source, returning the value of the program.
+// Syntax errors are returned as a *SyntaxError and Monkey runtime errors,
+// including panics inside the interpreter or in functions defined by the
+// host, as a *RuntimeError.
+func (in *Interpreter) Run(filename, source string) (object.Object, error) {
+	program, err := parse(filename, source)
+	if err != nil {
+		return nil, err
+	}
+	defer in.loader.enter(filename)()
+	return in.exec(program)
+}
+
+// exec runs a parsed program on the engine of the interpreter.
+func (in *Interpreter) exec(program *ast.Program) (object.Object, error) {
+	if in.env == nil {
+		return in.runVM(program)
+	}
+
+	// Undeclared identifiers are reported before the program runs, so
+	// the program is resolved as written, with the code the optimizer
+	// removes. On errors it is evaluated as is to report them.
+	if in.opts.Optimize && resolver.Resolve(program, in.env) == nil {
+		program = optimizer.Optimize(program)
+	}
+
+	result := evaluator.SafeEval(program, in.env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: err}
+	}
+	return result, nil
+}
+
+// Compile parses and compiles source to bytecode, which RunBytecode can
+// run later, possibly in another process. The program can use the globals
+// of the interpreter without declaring them, and gets the values the
+// interpreter running it has for them.
+func (in *Interpreter) Compile(filename, source string) (*compiler.Bytecode, error) {
+	program, err := parse(filename, source)
+	if err != nil {
+		return nil, err
+	}
+
+	symbolTable := newSymbolTable()
+	for _, name := range in.Names() {
+		symbolTable.Define(name)
+	}
+	return in.compile(program, symbolTable, nil)
+}
+
+// Names returns the sorted names of the globals set in the interpreter.
+func (in *Interpreter) Names() []string {
+	if in.env != nil {
+		return in.env.Names()
+	}
+	names := []string{}
+	for i, name := range in.symbolTable.Names() {
+		if name != "" && in.globals[i] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunBytecode runs a compiled program on a virtual machine, whatever the
+// engine of the interpreter. The globals of the program start out with
+// the values the interpreter has for their names.
+func (in *Interpreter) RunBytecode(bytecode *compiler.Bytecode) (object.Object, error) {
+	globals := make([]object.Object, vm.GlobalsSize)
+	for i, name := range bytecode.Globals {
+		if val, ok := in.Lookup(name); ok {
+			globals[i] = val
+		}
+	}
+	if len(bytecode.Positions) > 0 {
+		defer in.machineLoader().enter(bytecode.Positions[0].Pos.Filename)()
+	}
+	return in.runMachine(vm.NewWithGlobalsStore(bytecode, globals))
+}
+
+func parse(filename, source string) (*ast.Program, error) {
+	l := lexer.NewWithFilename(filename, source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &SyntaxError{Source: source, Diagnostics: p.Errors()}
+	}
+	return program, nil
+}
+
+// compileError reports an error found by the compiler as a runtime error,
+// as the evaluator only finds it when it gets there.
+func compileError(err error) error {
+	if err, ok := err.(*compiler.Error); ok {
+		return &RuntimeError{Err: &object.Error{
+			Message: err.Message,
+			Pos:     err.Pos,
+			Stack:   []*object.Frame{},
+		}}
+	}
+	return err
+}
+
+// runVM compiles program and runs it on a virtual machine sharing the
+// globals of earlier runs.
+func (in *Interpreter) runVM(program *ast.Program) (object.Object, error) {
+	bytecode, err := in.compile(program, in.symbolTable, in.constants)
+	if err != nil {
+		return nil, err
+	}
+	in.constants = bytecode.Constants
+
+	return in.runMachine(vm.NewWithGlobalsStore(bytecode, in.globals))
+}
+
+// compile compiles program against the globals in symbolTable, adding to
+// constants.
+func (in *Interpreter) compile(
+	program *ast.Program,
+	symbolTable *compiler.SymbolTable,
+	constants []object.Object,
+) (*compiler.Bytecode, error) {
+	if in.opts.Optimize {
+		// The compiler reports errors such as undeclared identifiers
+		// before the program runs, so the program is first compiled as
+		// written, with the code the optimizer removes. The copies keep
+		// that from declaring globals or adding constants.
+		check := compiler.NewWithState(symbolTable.Copy(), constants[:len(constants):len(constants)])
+		check.SetStrict(in.opts.Strict)
+		check.SetIncremental(in.opts.Incremental)
+		if err := check.Compile(program); err != nil {
+			return nil, compileError(err)
+		}
+		program = optimizer.Optimize(program)
+	}
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	comp.SetStrict(in.opts.Strict)
+	comp.SetIncremental(in.opts.Incremental)
+	if err := comp.Compile(program); err != nil {
+		return nil, compileError(err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// newSymbolTable returns the global scope of a new program, which holds
+// the builtins.
+func newSymbolTable() *compiler.SymbolTable {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	return symbolTable
+}
+
+func (in *Interpreter) runMachine(machine *vm.VM) (object.Object, error) {
+	machine.SetCheckedArithmetic(in.opts.CheckedArithmetic)
+	machine.SetImporter(in.machineLoader())
+	if in.opts.MaxCallDepth > 0 {
+		machine.SetMaxCallDepth(in.opts.MaxCallDepth)
+	}
+	if err := machine.Run(); err != nil {
+		if err, ok := err.(*object.Error); ok {
+			return nil, &RuntimeError{Err: err}
+		}
+		return nil, err
+	}
+	return machine.Result(), nil
+}
+
+// machineLoader returns the loader of the modules imported by programs
+// running on the VM. Their functions are compiled, so they cannot be
+// shared with the evaluator.
+func (in *Interpreter) machineLoader() *loader {
+	if in.opts.Engine == VM {
+		return in.loader
+	}
+	if in.vmLoader == nil {
+		opts := in.opts
+		opts.Engine = VM
+		in.vmLoader = newLoader(opts)
+	}
+	return in.vmLoader
+}
+
+// SyntaxError reports the diagnostics of a program that failed to parse.
+type SyntaxError struct {
+	Source      string
+	Diagnostics []*parser.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	msgs := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		msgs[i] = d.String()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Render formats the diagnostics with the offending source lines.
+func (e *SyntaxError) Render() string {
+	var sb strings.Builder
+	for _, d := range e.Diagnostics {
+		sb.WriteString(d.Render(e.Source))
+	}
+	return sb.String()
+}
+
+// RuntimeError wraps the Monkey error a program evaluated to.
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Message
+}
+
+// Internal reports whether the error was caused by a Go panic rather than
+// by the Monkey program.
+func (e *RuntimeError) Internal() bool {
+	return e.Err.Internal
+}
@@ -0,0 +1,361 @@
+package monkey
+
+import (
+	"os"
+	"path/filepath"
+	"playground/go-interpreter/src/compiler"
+	"playground/go-interpreter/src/object"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	interp := New(Options{})
+	interp.Define("base", &object.Integer{Value: 10})
+	interp.DefineFunc("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	result, err := interp.Run("test.mk", "let x = double(base) + 1; x")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "21" {
+		t.Errorf("wrong result. want=21, got=%s", result.Inspect())
+	}
+
+	x, ok := interp.Lookup("x")
+	if !ok || x.Inspect() != "21" {
+		t.Errorf("x not kept between runs. got=%v", x)
+	}
+	result, err = interp.Run("test.mk", "x * 2")
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("second run wrong. got=%v, %v", result, err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	interp := New(Options{CheckedArithmetic: true})
+
+	_, err := interp.Run("bad.mk", "let = 5;")
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("error is not *SyntaxError. got=%T (%v)", err, err)
+	}
+	if !strings.HasPrefix(syntaxErr.Error(), "bad.mk:1:5: error[P001]") {
+		t.Errorf("wrong syntax error. got=%q", syntaxErr.Error())
+	}
+
+	_, err = interp.Run("bad.mk", "9223372036854775807 + 1")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Internal() {
+		t.Errorf("overflow reported as internal error")
+	}
+	if runtimeErr.Error() != "integer overflow: 9223372036854775807 + 1" {
+		t.Errorf("wrong runtime error. got=%q", runtimeErr.Error())
+	}
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	interp := New(Options{})
+	interp.DefineFunc("explode", func(args ...object.Object) object.Object {
+		var m map[string]int
+		m["boom"] = 1
+		return nil
+	})
+
+	input := `let outer = fn() { inner() + 1 };
+let inner = fn() { explode() };
+outer()`
+
+	_, err := interp.Run("panic.mk", input)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if !runtimeErr.Internal() {
+		t.Errorf("error not marked as internal")
+	}
+	if !strings.HasPrefix(runtimeErr.Error(), "internal error: assignment to entry in nil map") {
+		t.Errorf("wrong message. got=%q", runtimeErr.Error())
+	}
+
+	stack := runtimeErr.Err.Stack
+	if len(stack) != 2 || stack[0].Function != "inner" || stack[1].Function != "outer" {
+		t.Fatalf("wrong stack. got=%v", stack)
+	}
+	if pos := runtimeErr.Err.Pos; pos.Line != 2 || pos.Column != 20 {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+
+	// The interpreter stays usable after the panic.
+	result, err := interp.Run("after.mk", "1 + 1")
+	if err != nil || result.Inspect() != "2" {
+		t.Errorf("interpreter unusable after panic. got=%v, %v", result, err)
+	}
+}
+
+func TestRunWithVM(t *testing.T) {
+	interp := New(Options{Engine: VM, CheckedArithmetic: true})
+	interp.Define("base", &object.Integer{Value: 10})
+	interp.DefineFunc("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	result, err := interp.Run("test.mk", "let x = double(base) + 1; const k = 2; x")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "21" {
+		t.Errorf("wrong result. want=21, got=%s", result.Inspect())
+	}
+
+	x, ok := interp.Lookup("x")
+	if !ok || x.Inspect() != "21" {
+		t.Errorf("x not kept between runs. got=%v", x)
+	}
+	result, err = interp.Run("test.mk", "let f = fn() { x * k }; f()")
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("second run wrong. got=%v, %v", result, err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"k = 3", "cannot assign to constant: k"},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"undefined", "identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Run("bad.mk", tt.input)
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Errorf("error is not *RuntimeError. got=%T (%v)", err, err)
+			continue
+		}
+		if runtimeErr.Error() != tt.expected {
+			t.Errorf("wrong runtime error. want=%q, got=%q", tt.expected, runtimeErr.Error())
+		}
+	}
+
+	interp.DefineFunc("explode", func(args ...object.Object) object.Object {
+		var m map[string]int
+		m["boom"] = 1
+		return nil
+	})
+	_, err = interp.Run("panic.mk", "let outer = fn() { explode() }; outer()")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok || !runtimeErr.Internal() {
+		t.Fatalf("panic not reported as internal error. got=%T (%v)", err, err)
+	}
+	if stack := runtimeErr.Err.Stack; len(stack) != 1 || stack[0].Function != "outer" {
+		t.Errorf("wrong stack. got=%v", stack)
+	}
+
+	result, err = interp.Run("after.mk", "x + 1")
+	if err != nil || result.Inspect() != "22" {
+		t.Errorf("interpreter unusable after errors. got=%v, %v", result, err)
+	}
+}
+
+func TestCompileAndRunBytecode(t *testing.T) {
+	compiling := New(Options{})
+	compiling.Define("base", &object.Integer{Value: 1})
+	bytecode, err := compiling.Compile("test.mk", "let f = fn(x) { x * base }; f(4)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	loaded := &compiler.Bytecode{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	// The program runs on the virtual machine with the globals of the
+	// interpreter, whatever its engine.
+	interp := New(Options{Engine: Evaluator})
+	interp.Define("base", &object.Integer{Value: 10})
+	result, err := interp.RunBytecode(loaded)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "40" {
+		t.Errorf("wrong result. want=40, got=%s", result.Inspect())
+	}
+
+	bytecode, err = New(Options{}).Compile("bad.mk", "let x = 1;\nx + true")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = New(Options{}).RunBytecode(bytecode)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if pos := runtimeErr.Err.Pos; pos.Filename != "bad.mk" || pos.Line != 2 {
+		t.Errorf("wrong error position. got=%s", pos)
+	}
+
+	if _, err := New(Options{}).Compile("bad.mk", "let = 1"); err == nil {
+		t.Errorf("expected syntax error, got none")
+	} else if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("error is not *SyntaxError. got=%T (%v)", err, err)
+	}
+
+	if _, err := New(Options{}).Compile("bad.mk", "base"); err == nil {
+		t.Errorf("expected error for undeclared identifier, got none")
+	} else if _, ok := err.(*RuntimeError); !ok {
+		t.Errorf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		engine   Engine
+		input    string
+		expected string // the result, or the error
+	}{
+		{Evaluator, "const k = 6; let f = fn(x) { x * k }; f(3 + 4)", "42"},
+		{VM, "const k = 6; let f = fn(x) { x * k }; f(3 + 4)", "42"},
+		{Evaluator, "if (1 > 2) { 1 } else { 2 * 3 }", "6"},
+		{VM, "if (1 > 2) { 1 } else { 2 * 3 }", "6"},
+		{Evaluator, "1 + (2 / 0)", "division by zero: 2 / 0"},
+		{VM, "1 + (2 / 0)", "division by zero: 2 / 0"},
+		// Errors found before the program runs are still reported for
+		// the code the optimizer removes.
+		{Evaluator, "if (false) { undefined }", "identifier not found: undefined"},
+		{VM, "if (false) { undefined }", "identifier not found: undefined"},
+		{VM, "const a = 1; if (false) { a = 2 }", "null"},
+	}
+
+	for _, tt := range tests {
+		interp := New(Options{Engine: tt.engine, Optimize: true})
+		result, err := interp.Run("test.mk", tt.input)
+
+		actual := ""
+		switch {
+		case err != nil:
+			actual = err.Error()
+		case result != nil:
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong outcome for %q on engine %d. want=%q, got=%q",
+				tt.input, tt.engine, tt.expected, actual)
+		}
+	}
+
+	// Checking the program before optimizing it declares nothing, so a
+	// strict interpreter accepts its declarations.
+	interp := New(Options{Engine: VM, Optimize: true, Strict: true})
+	if _, err := interp.Run("test.mk", "let x = 1; const y = 2; x + y"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := interp.Run("test.mk", "let x = 2"); err == nil || err.Error() != "identifier already declared: x" {
+		t.Errorf("wrong error for redeclaration in later run. got=%v", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/counter.mk": "let n = 0; export let next = fn() { n += 1; n }; export const step = 1; let hidden = 2",
+		"lib/twice.mk":   `import "./counter.mk" as c; export let twice = fn() { c.next(); c.next() }`,
+		"path/util.mk":   `export let greet = fn(name) { "hello " + name }`,
+		"a.mk":           `import "b.mk" as b; export let x = 1`,
+		"b.mk":           `import "a.mk" as a`,
+		"entry.mk":       `import "dep.mk" as dep; 1`,
+		"dep.mk":         `import "entry.mk" as entry`,
+		"bad.mk":         "let = 1",
+		"boom.mk":        "export let f = fn() {\n  1 / 0\n}",
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "main.mk")
+
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		// Every import of a file gets the same module.
+		{`import "lib/counter.mk" as c; import { twice } from "./lib/twice.mk"; c.next(); twice()`, "3"},
+		{`import { next, step as s } from "lib/counter.mk"; next() + s`, "2"},
+		{`import "lib/counter.mk" as c; c.hidden`, "module " + filepath.ToSlash(filepath.Join(dir, "lib/counter.mk")) + " has no export hidden"},
+		{`import { greet } from "util.mk"; greet("you")`, "hello you"},
+		{`import { greet } from "./util.mk"`, "module not found: ./util.mk"},
+		{`import "nowhere.mk" as n`, "module not found: nowhere.mk"},
+		{`import "bad.mk" as bad`, filepath.Join(dir, "bad.mk") + ":1:5: error[P001]: expected next token to be IDENT, got = instead"},
+		{`import { f } from "boom.mk"; f()`, "division by zero: 1 / 0"},
+	}
+
+	for _, engine := range []Engine{Evaluator, VM} {
+		for _, tt := range tests {
+			interp := New(Options{Engine: engine, ModulePath: []string{filepath.Join(dir, "path")}})
+			result, err := interp.Run(main, tt.input)
+
+			actual := ""
+			switch {
+			case err != nil:
+				actual = err.Error()
+			case result != nil:
+				actual = result.Inspect()
+			}
+			if actual != tt.expected {
+				t.Errorf("wrong outcome for %q on engine %d. want=%q, got=%q",
+					tt.input, engine, tt.expected, actual)
+			}
+		}
+
+		// Errors raised in a module keep their position there.
+		_, err := New(Options{Engine: engine}).Run(main, `import { f } from "boom.mk"; f()`)
+		if runtimeErr, ok := err.(*RuntimeError); !ok {
+			t.Errorf("error is not *RuntimeError. got=%T (%v)", err, err)
+		} else if pos := runtimeErr.Err.Pos; filepath.Base(pos.Filename) != "boom.mk" || pos.Line != 2 {
+			t.Errorf("wrong error position. got=%s", pos)
+		}
+
+		_, err = New(Options{Engine: engine}).Run(main, `import "a.mk" as a`)
+		if err == nil || !strings.HasPrefix(err.Error(), "import cycle: ") ||
+			strings.Count(err.Error(), " -> ") != 2 || !strings.HasSuffix(err.Error(), "a.mk") {
+			t.Errorf("wrong error for import cycle. got=%v", err)
+		}
+
+		// The file being run is loading too, and does not run again.
+		entry := filepath.Join(dir, "entry.mk")
+		_, err = New(Options{Engine: engine}).Run(entry, files["entry.mk"])
+		if err == nil || !strings.HasPrefix(err.Error(), "import cycle: ") ||
+			strings.Count(err.Error(), " -> ") != 2 || !strings.HasSuffix(err.Error(), "entry.mk") {
+			t.Errorf("wrong error for import cycle through the entry file. got=%v", err)
+		}
+	}
+
+	// A compiled program imports modules compiled for the VM, whatever
+	// the engine of the interpreter.
+	bytecode, err := New(Options{}).Compile(main, `import { twice } from "lib/twice.mk"; twice()`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	result, err := New(Options{Engine: Evaluator}).RunBytecode(bytecode)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "2" {
+		t.Errorf("wrong result. want=2, got=%s", result.Inspect())
+	}
+}
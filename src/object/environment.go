@@ -1,28 +1,261 @@
 package object
 
+import (
+	"playground/go-interpreter/src/ast"
+	"sort"
+)
+
+// DefaultMaxCallDepth is the call depth limit of a new environment.
+const DefaultMaxCallDepth = 10000
+
+// MaxCallDepthLimit is the highest call depth limit an environment
+// takes. Every call the evaluator nests takes Go stack, which would
+// overflow, ending the process, before a few hundred thousand calls.
+const MaxCallDepthLimit = 50000
+
+// Environment holds the variables of the program or of a function call
+// in slots, which the resolver assigns to their names ahead of time.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  []Object // nil for slots whose variable is not set yet
+	consts []bool
+	// sites holds the declaration that last bound each slot, if any.
+	sites []*ast.Identifier
+	// names maps the names of global variables to their slots. The
+	// variables of function calls are only known by slot.
+	names  map[string]int
+	outer  *Environment
+	frame  *Frame
+	strict bool
+	// checked makes integer overflow an error instead of wrapping.
+	checked bool
+	// maxDepth is the number of nested function calls allowed.
+	maxDepth int
+	importer Importer
+	// incremental lets functions refer to globals declared by programs
+	// run in e later.
+	incremental bool
 }
 
 func NewEnclosedEnvironment(out *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = out
+	env := &Environment{outer: out}
+	env.strict = out.strict
+	env.checked = out.checked
+	env.maxDepth = out.maxDepth
+	env.importer = out.importer
 	return env
 }
 
+// NewCallEnvironment creates the environment for a function call
+// described by frame.
+func NewCallEnvironment(out *Environment, frame *Frame) *Environment {
+	env := NewEnclosedEnvironment(out)
+	env.frame = frame
+	return env
+}
+
+// NewEnvironment creates the global environment of a program.
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	n := make(map[string]int)
+	return &Environment{names: n, outer: nil, maxDepth: DefaultMaxCallDepth}
 }
+
+// Get returns the value of the global variable name.
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	for env := e; env != nil; env = env.outer {
+		if slot, ok := env.names[name]; ok && env.store[slot] != nil {
+			return env.store[slot], true
+		}
 	}
-	return obj, ok
+	return nil, false
 }
+
+// Frame returns the call frame the environment belongs to, or nil at the
+// top level.
+func (e *Environment) Frame() *Frame {
+	for env := e; env != nil; env = env.outer {
+		if env.frame != nil {
+			return env.frame
+		}
+	}
+	return nil
+}
+
+// Set binds the variable name of e to obj, declaring it if needed.
 func (e *Environment) Set(name string, obj Object) Object {
-	e.store[name] = obj
+	return e.SetAt(e.Declare(name), obj)
+}
+
+// Declare returns the slot of the variable name of e, which is allocated
+// the first time a name is declared.
+func (e *Environment) Declare(name string) int {
+	if slot, ok := e.names[name]; ok {
+		return slot
+	}
+	if e.names == nil {
+		e.names = make(map[string]int)
+	}
+	slot := len(e.names)
+	e.names[name] = slot
+	e.grow(slot)
+	return slot
+}
+
+// Slot returns the slot of the variable name of e, if it was declared.
+func (e *Environment) Slot(name string) (int, bool) {
+	slot, ok := e.names[name]
+	return slot, ok
+}
+
+// grow makes room for slot in e.
+func (e *Environment) grow(slot int) {
+	for len(e.store) <= slot {
+		e.store = append(e.store, nil)
+		e.consts = append(e.consts, false)
+		e.sites = append(e.sites, nil)
+	}
+}
+
+// GetAt returns the variable in slot of the environment depth levels out
+// from e. It reports false if the variable is not set.
+func (e *Environment) GetAt(depth, slot int) (Object, bool) {
+	env := e.ancestor(depth)
+	if slot >= len(env.store) || env.store[slot] == nil {
+		return nil, false
+	}
+	return env.store[slot], true
+}
+
+// SetAt binds the variable in slot of e to obj.
+func (e *Environment) SetAt(slot int, obj Object) Object {
+	e.grow(slot)
+	e.store[slot] = obj
+	e.consts[slot] = false
+	e.sites[slot] = nil
 	return obj
 }
+
+// SetConstAt binds the variable in slot of e to obj and marks the binding
+// read-only.
+func (e *Environment) SetConstAt(slot int, obj Object) Object {
+	e.SetAt(slot, obj)
+	e.consts[slot] = true
+	return obj
+}
+
+// SetSiteAt records that the variable in slot of e was bound by the
+// declaration of the name site.
+func (e *Environment) SetSiteAt(slot int, site *ast.Identifier) {
+	e.grow(slot)
+	e.sites[slot] = site
+}
+
+// SiteAt returns the declaration that bound the variable in slot of e,
+// or nil if it was bound in another way.
+func (e *Environment) SiteAt(slot int) *ast.Identifier {
+	if slot >= len(e.sites) {
+		return nil
+	}
+	return e.sites[slot]
+}
+
+// DefinesAt reports whether the variable in slot of e itself is set.
+func (e *Environment) DefinesAt(slot int) bool {
+	return slot < len(e.store) && e.store[slot] != nil
+}
+
+// IsConstAt reports whether the variable in slot of the environment depth
+// levels out from e is read-only.
+func (e *Environment) IsConstAt(depth, slot int) bool {
+	env := e.ancestor(depth)
+	return slot < len(env.consts) && env.consts[slot]
+}
+
+// AssignAt rebinds the variable in slot of the environment depth levels
+// out from e. It reports false if the variable is not set.
+func (e *Environment) AssignAt(depth, slot int, obj Object) (Object, bool) {
+	env := e.ancestor(depth)
+	if !env.DefinesAt(slot) {
+		return nil, false
+	}
+	env.store[slot] = obj
+	return obj, true
+}
+
+func (e *Environment) ancestor(depth int) *Environment {
+	env := e
+	for i := 0; i < depth; i++ {
+		env = env.outer
+	}
+	return env
+}
+
+// SetStrict turns strict mode on or off for e and the environments
+// enclosed by it afterwards. In strict mode a name may only be declared
+// once per scope.
+func (e *Environment) SetStrict(strict bool) {
+	e.strict = strict
+}
+
+func (e *Environment) Strict() bool {
+	return e.strict
+}
+
+// SetIncremental makes the programs run in e parts of one session, as
+// the inputs of the REPL are. Functions can then refer to globals that
+// no program has declared yet, and using one before a later program
+// declares it is a runtime error.
+func (e *Environment) SetIncremental(incremental bool) {
+	e.incremental = incremental
+}
+
+func (e *Environment) Incremental() bool {
+	return e.incremental
+}
+
+// SetCheckedArithmetic turns overflow checking of integer arithmetic on
+// or off for e and the environments enclosed by it afterwards.
+func (e *Environment) SetCheckedArithmetic(checked bool) {
+	e.checked = checked
+}
+
+func (e *Environment) CheckedArithmetic() bool {
+	return e.checked
+}
+
+// SetMaxCallDepth limits the nesting of function calls made from e and
+// the environments enclosed by it afterwards, to at most
+// MaxCallDepthLimit.
+func (e *Environment) SetMaxCallDepth(depth int) {
+	if depth > MaxCallDepthLimit {
+		depth = MaxCallDepthLimit
+	}
+	e.maxDepth = depth
+}
+
+func (e *Environment) MaxCallDepth() int {
+	return e.maxDepth
+}
+
+// SetImporter sets the importer that loads the modules imported from e
+// and the environments enclosed by it afterwards.
+func (e *Environment) SetImporter(importer Importer) {
+	e.importer = importer
+}
+
+// Importer returns the importer of e, or nil if e cannot import modules.
+func (e *Environment) Importer() Importer {
+	return e.importer
+}
+
+// Names returns the names of the variables set in e itself, without its
+// outer environments, in sorted order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.names))
+	for name, slot := range e.names {
+		if e.store[slot] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
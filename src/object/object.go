@@ -4,24 +4,36 @@ import (
 	"bytes"
 	"fmt"
 	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/code"
+	"playground/go-interpreter/src/token"
 	"strings"
 
 	"hash/fnv"
+	"math"
+	"strconv"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	MODULE_OBJ       = "MODULE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
 )
 
 type BuiltinFunction func(args ...Object) Object
@@ -42,6 +54,21 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -73,21 +100,141 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// Break and Continue are produced by break and continue statements and
+// unwind the enclosing blocks up to the innermost loop.
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+// TailCall is a call in tail position that the evaluator has yet to
+// make. It never reaches Monkey code.
+type TailCall struct {
+	Function  *Function
+	Arguments []Object
+	Call      *ast.CallExpression
+}
+
+func (tc *TailCall) Type() ObjectType {
+	return TAIL_CALL_OBJ
+}
+func (tc *TailCall) Inspect() string {
+	return "tail call " + tc.Call.String()
+}
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
 type Error struct {
-	Message string
+	Message  string
+	Pos      token.Position // where the error was raised
+	Stack    []*Frame       // active calls when the error was raised, innermost first
+	Internal bool           // set for errors caused by a bug in the interpreter
+	Value    Object         // the thrown value for errors raised by throw
 }
 
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
+
+// Error makes an *Error usable as a Go error.
+func (e *Error) Error() string {
+	return e.Message
+}
 func (e *Error) Inspect() string {
-	return "Error: " + e.Message
+	if len(e.Stack) == 0 {
+		if e.Pos.IsValid() {
+			return e.Pos.String() + ": Error: " + e.Message
+		}
+		return "Error: " + e.Message
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("Traceback (most recent call last):\n")
+	last, repeated := "", 0
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		caller := "<main>"
+		if i+1 < len(e.Stack) {
+			caller = e.Stack[i+1].FunctionName()
+		}
+		line := fmt.Sprintf("  %s, in %s\n", e.Stack[i].CallSite, caller)
+		if n := e.Stack[i].TailCalls; n == 1 {
+			line += "  [1 tail call elided]\n"
+		} else if n > 1 {
+			line += fmt.Sprintf("  [%d tail calls elided]\n", n)
+		}
+		if line == last {
+			repeated++
+			if repeated >= maxRepeatedFrames {
+				continue
+			}
+		} else {
+			writeRepeated(&buf, repeated)
+			last, repeated = line, 0
+		}
+		buf.WriteString(line)
+	}
+	writeRepeated(&buf, repeated)
+	buf.WriteString(fmt.Sprintf("  %s, in %s\n", e.Pos, e.Stack[0].FunctionName()))
+	buf.WriteString("Error: " + e.Message)
+
+	return buf.String()
+}
+
+// maxRepeatedFrames is the number of times an identical traceback line is
+// printed before the rest of its repetitions are summarised.
+const maxRepeatedFrames = 3
+
+func writeRepeated(buf *bytes.Buffer, repeated int) {
+	if n := repeated - maxRepeatedFrames + 1; n > 0 {
+		buf.WriteString(fmt.Sprintf("  [previous line repeated %d more times]\n", n))
+	}
+}
+
+// Frame is an entry of the call stack, created for every call of a
+// Monkey function.
+type Frame struct {
+	Function  string // empty for anonymous functions
+	CallSite  token.Position
+	Caller    *Frame
+	Depth     int // number of frames up to and including this one
+	TailCalls int // number of tail calls that replaced the function called at CallSite
+}
+
+func (f *Frame) FunctionName() string {
+	if f.Function == "" {
+		return "<anonymous>"
+	}
+	return f.Function
+}
+
+// Stack returns the frames from f up to the outermost call.
+func (f *Frame) Stack() []*Frame {
+	frames := []*Frame{}
+	for frame := f; frame != nil; frame = frame.Caller {
+		frames = append(frames, frame)
+	}
+	return frames
 }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string
 }
 
 func (f *Function) Type() ObjectType {
@@ -97,14 +244,21 @@ func (f *Function) Inspect() string {
 	var buf bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	buf.WriteString("fn")
 	buf.WriteString("(")
 	buf.WriteString(strings.Join(params, ", "))
-	buf.WriteString("{\n")
+	buf.WriteString(") {\n")
 	buf.WriteString(f.Body.String())
 	buf.WriteString("\n}")
 
@@ -113,6 +267,10 @@ func (f *Function) Inspect() string {
 
 type String struct {
 	Value string
+	// hash caches the hash of Value once computed; Value must not
+	// change after HashKey has been called.
+	hash   uint64
+	hashed bool
 }
 
 func (s *String) Type() ObjectType {
@@ -133,8 +291,146 @@ func (b *Builtin) Inspect() string {
 	return "builtin function"
 }
 
+// Module is an imported file, seen from the importing program through
+// the bindings the file exports.
+type Module struct {
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+func (m *Module) Inspect() string {
+	return "<module " + m.Path + ">"
+}
+
+// Get returns the value the module exports as name.
+func (m *Module) Get(name string) (Object, bool) {
+	val, ok := m.Exports[name]
+	return val, ok
+}
+
+// Importer loads the modules of import statements.
+type Importer interface {
+	// Import returns the module at path, as written in an import
+	// statement of the file from.
+	Import(path, from string) (*Module, error)
+}
+
+// CompiledFunction is the bytecode of a function literal, found in the
+// constant pool of a compiled program.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int  // not counting the rest parameter
+	NumDefaults   int  // trailing parameters with a default value
+	Rest          bool // whether the function has a rest parameter
+	Name          string
+	// Source is the function literal as Function.Inspect shows it, which
+	// its closures show too.
+	Source    string
+	Positions code.SourceMap
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function together with the variables it shares
+// with the functions it was created in. To Monkey code it is a function
+// like any other.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+	// Program is the program the closure was created by, whose constants
+	// and globals the function uses wherever it is called from.
+	Program *Program
+}
+
+// Program holds the state of a compiled program that its functions
+// share while it runs.
+type Program struct {
+	Constants   []Object
+	Globals     []Object
+	GlobalNames []string // by index, for error messages
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+func (c *Closure) Inspect() string {
+	return c.Fn.Source
+}
+
+// Cell holds a local variable of a compiled function that closures
+// capture, so that assignments through any of them are seen by all. It
+// never reaches Monkey code.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+func (c *Cell) Inspect() string {
+	return "cell " + c.Value.Inspect()
+}
+
 type Array struct {
 	Elements []Object
+	// store is set when Elements may share its backing array with other
+	// arrays made by Push or Rest. Such an array is copied before it is
+	// modified in place.
+	store *arrayStore
+}
+
+// arrayStore records how much of a shared backing array is in use.
+type arrayStore struct {
+	used int
+}
+
+// Push returns a new array with x appended to the elements of a. When a
+// ends where the used part of its backing array ends, the new array
+// extends it in place, so building an array one push at a time takes
+// amortised constant time per element.
+func (a *Array) Push(x Object) *Array {
+	n := len(a.Elements)
+	if a.store != nil && a.store.used == n && n < cap(a.Elements) {
+		a.store.used++
+		return &Array{Elements: append(a.Elements, x), store: a.store}
+	}
+
+	elements := make([]Object, n+1, 2*n+1)
+	copy(elements, a.Elements)
+	elements[n] = x
+	return &Array{Elements: elements, store: &arrayStore{used: n + 1}}
+}
+
+// Rest returns a new array with all elements of a but the first, sharing
+// the backing array of a. a must not be empty.
+func (a *Array) Rest() *Array {
+	n := len(a.Elements)
+	if a.store == nil {
+		a.store = &arrayStore{used: n}
+	}
+	// Limiting the capacity keeps pushes to the result from writing
+	// into elements a may still use.
+	return &Array{Elements: a.Elements[1:n:n], store: a.store}
+}
+
+// SetElement replaces the element at index i, first copying the elements
+// if they are shared with another array.
+func (a *Array) SetElement(i int, x Object) {
+	if a.store != nil {
+		elements := make([]Object, len(a.Elements))
+		copy(elements, a.Elements)
+		a.Elements, a.store = elements, nil
+	}
+	a.Elements[i] = x
 }
 
 func (a *Array) Type() ObjectType {
@@ -181,22 +477,108 @@ func (i *Integer) HashKey() HashKey {
 	}
 }
 
+func (f *Float) HashKey() HashKey {
+	value := f.Value
+	if value == 0 {
+		value = 0 // -0.0 and 0.0 are the same key
+	}
+	return HashKey{
+		Type:  f.Type(),
+		Value: math.Float64bits(value),
+	}
+}
+
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
+	if !s.hashed {
+		h := fnv.New64a()
+		h.Write([]byte(s.Value))
+		s.hash, s.hashed = h.Sum64(), true
+	}
 	return HashKey{
 		Type:  s.Type(),
-		Value: h.Sum64(),
+		Value: s.hash,
+	}
+}
+
+// equalKeys reports whether a and b are the same hash key. Keys whose
+// HashKey collides are told apart by their values.
+func equalKeys(a, b Hashable) bool {
+	switch a := a.(type) {
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *Float:
+		b, ok := b.(*Float)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
 	}
+	return a == b
 }
 
 type HashPair struct {
-	Key   Object
+	Key   Hashable
 	Value Object
 }
 
+// Hash maps hashable keys to values, remembering the order in which the
+// keys were first inserted. The zero value is an empty hash.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	// index holds the positions in pairs of the keys with a given
+	// HashKey. Almost every bucket has a single entry; more only when
+	// distinct keys collide.
+	index map[HashKey][]int
+	pairs []HashPair
+}
+
+// lookup returns the position of key in h.pairs, or -1.
+func (h *Hash) lookup(key Hashable, hashed HashKey) int {
+	for _, i := range h.index[hashed] {
+		if equalKeys(h.pairs[i].Key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value stored for key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i := h.lookup(key, key.HashKey())
+	if i < 0 {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Set stores value for key. A new key goes after all existing ones, while
+// an existing key keeps its position.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashed := key.HashKey()
+	if i := h.lookup(key, hashed); i >= 0 {
+		h.pairs[i] = HashPair{Key: key, Value: value}
+		return
+	}
+
+	if h.index == nil {
+		h.index = make(map[HashKey][]int)
+	}
+	h.index[hashed] = append(h.index[hashed], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+// Len returns the number of keys in h.
+func (h *Hash) Len() int {
+	return len(h.pairs)
+}
+
+// Pairs returns the entries of h in insertion order. The slice must not
+// be modified.
+func (h *Hash) Pairs() []HashPair {
+	return h.pairs
 }
 
 func (h *Hash) Type() ObjectType {
@@ -206,7 +588,7 @@ func (h *Hash) Inspect() string {
 	var buf bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	buf.WriteString("{")
@@ -217,5 +599,6 @@ func (h *Hash) Inspect() string {
 }
 
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
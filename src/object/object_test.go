@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"playground/go-interpreter/src/token"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -18,3 +21,134 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestArrayPushAndRestDoNotAlias(t *testing.T) {
+	one, two, three := &Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}
+
+	base := (&Array{}).Push(one).Push(two)
+	withThree := base.Push(three)
+	withOne := base.Push(one)
+	if withThree.Inspect() != "[1, 2, 3]" || withOne.Inspect() != "[1, 2, 1]" {
+		t.Errorf("pushes to the same array interfere. got=%s and %s",
+			withThree.Inspect(), withOne.Inspect())
+	}
+
+	rest := withThree.Rest()
+	rest.SetElement(0, three)
+	if withThree.Inspect() != "[1, 2, 3]" || rest.Inspect() != "[3, 3]" {
+		t.Errorf("setting an element of rest changed its source. got=%s and %s",
+			withThree.Inspect(), rest.Inspect())
+	}
+
+	base.SetElement(0, three)
+	if withThree.Inspect() != "[1, 2, 3]" || base.Inspect() != "[3, 2]" {
+		t.Errorf("setting an element changed a pushed array. got=%s and %s",
+			withThree.Inspect(), base.Inspect())
+	}
+
+	pushedRest := withOne.Rest().Push(three)
+	if withOne.Inspect() != "[1, 2, 1]" || pushedRest.Inspect() != "[2, 1, 3]" {
+		t.Errorf("pushing to rest changed its source. got=%s and %s",
+			withOne.Inspect(), pushedRest.Inspect())
+	}
+}
+
+func TestHashKeyCollisions(t *testing.T) {
+	a := &String{Value: "a"}
+	b := &String{Value: "b"}
+	// Give b the cached hash of a, as if the two strings collided.
+	b.hash, b.hashed = a.HashKey().Value, true
+	if a.HashKey() != b.HashKey() {
+		t.Fatalf("test strings do not collide")
+	}
+
+	h := &Hash{}
+	h.Set(a, &Integer{Value: 1})
+	h.Set(b, &Integer{Value: 2})
+	h.Set(&String{Value: "a"}, &Integer{Value: 3})
+
+	if h.Len() != 2 {
+		t.Fatalf("colliding keys overwrite each other. got=%s", h.Inspect())
+	}
+	if val, ok := h.Get(&String{Value: "a"}); !ok || val.Inspect() != "3" {
+		t.Errorf("wrong value for a. got=%v", val)
+	}
+	if val, ok := h.Get(b); !ok || val.Inspect() != "2" {
+		t.Errorf("wrong value for b. got=%v", val)
+	}
+	if h.Inspect() != "{a: 3, b: 2}" {
+		t.Errorf("wrong hash. got=%s", h.Inspect())
+	}
+
+	// Keys of different types never match, even with equal hashes.
+	h.Set(&Integer{Value: 1}, &Boolean{Value: true})
+	if _, ok := h.Get(&Float{Value: 1}); ok {
+		t.Errorf("float key found an integer entry")
+	}
+}
+
+func TestStringHashKeyIsCached(t *testing.T) {
+	s := &String{Value: "cached"}
+	first := s.HashKey()
+	if !s.hashed || s.hash != first.Value {
+		t.Fatalf("hash not cached")
+	}
+	if s.HashKey() != first {
+		t.Errorf("cached hash differs")
+	}
+}
+
+func TestEnvironmentSlots(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("a", &Integer{Value: 1})
+	slot := global.Declare("b")
+
+	if _, ok := global.GetAt(0, slot); ok {
+		t.Errorf("declared variable reported as set")
+	}
+	if names := global.Names(); len(names) != 1 || names[0] != "a" {
+		t.Errorf("wrong names. got=%v", names)
+	}
+
+	call := NewCallEnvironment(global, nil)
+	call.SetConstAt(2, &Integer{Value: 3})
+
+	if val, ok := call.GetAt(1, 0); !ok || val.Inspect() != "1" {
+		t.Errorf("wrong outer variable. got=%v", val)
+	}
+	if _, ok := call.GetAt(0, 1); ok {
+		t.Errorf("unset slot reported as set")
+	}
+	if !call.IsConstAt(0, 2) || call.IsConstAt(1, 0) {
+		t.Errorf("wrong constness")
+	}
+
+	if _, ok := call.AssignAt(1, slot, &Integer{Value: 2}); ok {
+		t.Errorf("assigned to a variable that is not set")
+	}
+	if _, ok := call.AssignAt(1, 0, &Integer{Value: 5}); !ok {
+		t.Errorf("assignment to outer variable failed")
+	}
+	if val, ok := global.Get("a"); !ok || val.Inspect() != "5" {
+		t.Errorf("assignment not visible by name. got=%v", val)
+	}
+}
+
+func TestErrorInspectWithoutStack(t *testing.T) {
+	tests := []struct {
+		err      *Error
+		expected string
+	}{
+		{&Error{Message: "boom"}, "Error: boom"},
+		{&Error{Message: "boom", Stack: []*Frame{}}, "Error: boom"},
+		{&Error{Message: "boom", Pos: token.Position{Filename: "a.mk", Line: 2, Column: 5}},
+			"a.mk:2:5: Error: boom"},
+		{&Error{Message: "boom", Pos: token.Position{Line: 1, Column: 1}}, "1:1: Error: boom"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
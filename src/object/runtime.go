@@ -0,0 +1,101 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// The values both engines use for null and the booleans, so that values
+// passed between them, such as those of imported modules, compare equal.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// IsTruthy reports whether obj counts as true in a condition: every value
+// except false and null does.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// NewError returns a runtime error, which the engine raising it locates.
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// IntegerArithmetic returns the wrapped-around result of a op b, where
+// op is one of + - * / %, and reports whether the exact result does not
+// fit in an int64. b must not be zero for / and %.
+func IntegerArithmetic(op string, a, b int64) (int64, bool) {
+	switch op {
+	case "+":
+		r := a + b
+		return r, (a >= 0) == (b >= 0) && (r >= 0) != (a >= 0)
+	case "-":
+		r := a - b
+		return r, (a >= 0) != (b >= 0) && (r >= 0) != (a >= 0)
+	case "*":
+		r := a * b
+		overflow := a != 0 && (r/a != b || a == -1 && b == math.MinInt64)
+		return r, overflow
+	case "/":
+		return a / b, a == math.MinInt64 && b == -1
+	default:
+		return a % b, false
+	}
+}
+
+// ThrownMessage returns the message of an error raised by throwing val.
+func ThrownMessage(val Object) string {
+	switch val := val.(type) {
+	case *String:
+		return val.Value
+	case *Hash:
+		// Rethrowing a caught error keeps its message.
+		if message, ok := val.Get(&String{Value: "message"}); ok {
+			if msg, ok := message.(*String); ok {
+				return msg.Value
+			}
+		}
+	}
+	return val.Inspect()
+}
+
+// CaughtError returns the hash a catch block sees for err, with the keys
+// "message", "position", "stack" (the active calls, innermost first) and
+// "value" (what was thrown, or null for runtime errors).
+func CaughtError(err *Error) *Hash {
+	stack := make([]Object, len(err.Stack))
+	for i, frame := range err.Stack {
+		stack[i] = &String{
+			Value: fmt.Sprintf("%s (%s)", frame.FunctionName(), frame.CallSite),
+		}
+	}
+
+	var value Object = NULL
+	if err.Value != nil {
+		value = err.Value
+	}
+
+	hash := &Hash{}
+	for _, field := range []struct {
+		key   string
+		value Object
+	}{
+		{"message", &String{Value: err.Message}},
+		{"position", &String{Value: err.Pos.String()}},
+		{"stack", &Array{Elements: stack}},
+		{"value", value},
+	} {
+		hash.Set(&String{Value: field.key}, field.value)
+	}
+	return hash
+}
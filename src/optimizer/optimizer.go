@@ -0,0 +1,482 @@
+// Package optimizer rewrites the syntax tree of a program into one that
+// does less work when it runs. It folds operators whose operands are
+// literals, drops the branches of if expressions that a literal condition
+// never takes, and replaces the uses of immutable variables bound to
+// literals with the literals.
+//
+// The rewritten program computes the same values and raises the same
+// errors at run time. Errors found before a program runs, such as
+// undeclared identifiers, are not reported for the code the optimizer
+// removes, so the engine should check the program before optimizing it.
+package optimizer
+
+import (
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/evaluator"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/token"
+	"strconv"
+)
+
+// Optimize rewrites program in place and returns it.
+func Optimize(program *ast.Program) *ast.Program {
+	// Overflow is an error in the environment operators are folded in,
+	// so that only the program decides whether it wraps around.
+	env := object.NewEnvironment()
+	env.SetCheckedArithmetic(true)
+
+	o := &optimizer{env: env, scope: newScope(nil, program)}
+	program.Statements = o.statements(program.Statements, true)
+	return program
+}
+
+type optimizer struct {
+	env   *object.Environment
+	scope *scope
+}
+
+// scope tracks the variables of the program or of a function.
+type scope struct {
+	outer  *scope
+	global bool
+	// declared counts the declarations of each name in the scope,
+	// including parameters and those in nested blocks, but not those in
+	// nested functions.
+	declared map[string]int
+	// assigned holds the names assigned to anywhere in the scope,
+	// including nested functions.
+	assigned map[string]bool
+	// literals holds the values of the immutable variables declared so
+	// far.
+	literals map[string]ast.Expression
+}
+
+// newScope creates the scope of node, which is the program or a function
+// literal.
+func newScope(outer *scope, node ast.Node) *scope {
+	s := &scope{
+		outer:    outer,
+		declared: make(map[string]int),
+		assigned: make(map[string]bool),
+		literals: make(map[string]ast.Expression),
+	}
+	_, s.global = node.(*ast.Program)
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			s.declared[n.Name.Value]++
+		case *ast.ImportStatement:
+			if n.Name != nil {
+				s.declared[n.Name.Value]++
+			}
+			for _, m := range n.Members {
+				s.declared[m.Name.Value]++
+			}
+		case *ast.ForStatement:
+			if n.Key != nil {
+				s.declared[n.Key.Value]++
+			}
+			s.declared[n.Value.Value]++
+		case *ast.TryExpression:
+			if n.Catch != nil {
+				s.declared[n.CatchParam.Value]++
+			}
+		case *ast.FunctionLiteral:
+			if n != node {
+				return false
+			}
+			for _, param := range n.Parameters {
+				s.declared[param.Value]++
+			}
+			if n.Rest != nil {
+				s.declared[n.Rest.Value]++
+			}
+		}
+		return true
+	})
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n, ok := n.(*ast.AssignExpression); ok {
+			if target, ok := n.Target.(*ast.Identifier); ok {
+				s.assigned[target.Value] = true
+			}
+		}
+		return true
+	})
+
+	return s
+}
+
+// bind records the variable declared by let for inlining if it is bound
+// to a literal and nothing can change it afterwards: it is a constant,
+// or a variable of a function that is declared once and never assigned
+// to. The variables of the program itself can also be assigned by code
+// from earlier runs, so only its constants are inlined.
+func (s *scope) bind(let *ast.LetStatement) {
+	name := let.Name.Value
+	if !isLiteral(let.Value) || s.declared[name] != 1 {
+		return
+	}
+	if !let.IsConst() && (s.global || s.assigned[name]) {
+		return
+	}
+	s.literals[name] = let.Value
+}
+
+// lookup returns the literal the variable name refers to, if it is an
+// immutable variable that has been declared.
+func (s *scope) lookup(name string) (ast.Expression, bool) {
+	for ; s != nil; s = s.outer {
+		if lit, ok := s.literals[name]; ok {
+			return lit, true
+		}
+		if s.declared[name] > 0 {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// statements optimizes a list of statements, into which it splices the
+// statements of the branches taken by if expressions with a literal
+// condition. The variables declared by the statements of a program or
+// function body, which run in order whenever the body does, are recorded
+// for inlining when direct is set.
+func (o *optimizer) statements(list []ast.Statement, direct bool) []ast.Statement {
+	out := make([]ast.Statement, 0, len(list))
+
+	for i, s := range list {
+		es, ok := s.(*ast.ExpressionStatement)
+		if !ok {
+			out = append(out, o.statement(s, direct))
+			continue
+		}
+		ie, ok := es.Expression.(*ast.IfExpression)
+		if !ok {
+			out = append(out, o.statement(s, direct))
+			continue
+		}
+
+		ie.Condition = o.expr(ie.Condition)
+		if !isLiteral(ie.Condition) || declares(dead(ie)) {
+			ie.Consequence = o.block(ie.Consequence)
+			if ie.Alternative != nil {
+				ie.Alternative = o.block(ie.Alternative)
+			}
+			out = append(out, es)
+			continue
+		}
+
+		// A break or continue leaves the block it is in, which it would
+		// no longer do once spliced into the list.
+		branch := taken(ie)
+		if branch != nil && escapes(branch) {
+			o.block(branch)
+			es.Expression = trim(ie)
+			out = append(out, es)
+			continue
+		}
+
+		var statements []ast.Statement
+		if branch != nil {
+			statements = o.statements(branch.Statements, direct)
+		}
+		if len(statements) == 0 && i == len(list)-1 {
+			// The if is the value of the list, which is null or nothing
+			// depending on whether there is a branch to take.
+			es.Expression = trim(ie)
+			out = append(out, es)
+			continue
+		}
+		out = append(out, statements...)
+	}
+
+	return out
+}
+
+func (o *optimizer) statement(s ast.Statement, direct bool) ast.Statement {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		s.Value = o.expr(s.Value)
+		if direct {
+			o.scope.bind(s)
+		}
+	case *ast.ExportStatement:
+		o.statement(s.Statement, direct)
+	case *ast.ReturnStatement:
+		s.ReturnValue = o.expr(s.ReturnValue)
+	case *ast.ThrowStatement:
+		s.Value = o.expr(s.Value)
+	case *ast.ExpressionStatement:
+		s.Expression = o.expr(s.Expression)
+	case *ast.WhileStatement:
+		s.Condition = o.expr(s.Condition)
+		s.Body = o.block(s.Body)
+	case *ast.ForStatement:
+		s.Iterable = o.expr(s.Iterable)
+		s.Body = o.block(s.Body)
+	case *ast.BlockStatement:
+		return o.block(s)
+	}
+	return s
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) *ast.BlockStatement {
+	block.Statements = o.statements(block.Statements, false)
+	return block
+}
+
+func (o *optimizer) expr(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if lit, ok := o.scope.lookup(e.Value); ok {
+			return copyLiteral(lit, e.Token)
+		}
+
+	case *ast.PrefixExpression:
+		e.Right = o.expr(e.Right)
+		if isLiteral(e.Right) {
+			return o.fold(e)
+		}
+
+	case *ast.InfixExpression:
+		e.Left = o.expr(e.Left)
+		if isLiteral(e.Left) && !declares(e.Right) {
+			// The right operand is not evaluated when the left one
+			// decides the result.
+			if e.Operator == "&&" && !truthy(e.Left) {
+				return newBoolean(false, e.Pos(), e.End())
+			}
+			if e.Operator == "||" && truthy(e.Left) {
+				return newBoolean(true, e.Pos(), e.End())
+			}
+		}
+		e.Right = o.expr(e.Right)
+		if isLiteral(e.Left) && isLiteral(e.Right) {
+			return o.fold(e)
+		}
+
+	case *ast.AssignExpression:
+		if _, ok := e.Target.(*ast.Identifier); !ok {
+			e.Target = o.expr(e.Target)
+		}
+		e.Value = o.expr(e.Value)
+
+	case *ast.IfExpression:
+		return o.ifExpression(e)
+
+	case *ast.TryExpression:
+		e.Block = o.block(e.Block)
+		if e.Catch != nil {
+			e.Catch = o.block(e.Catch)
+		}
+		if e.Finally != nil {
+			e.Finally = o.block(e.Finally)
+		}
+
+	case *ast.FunctionLiteral:
+		o.function(e)
+
+	case *ast.CallExpression:
+		e.Function = o.expr(e.Function)
+		for i, arg := range e.Arguments {
+			e.Arguments[i] = o.expr(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for i, el := range e.Elements {
+			e.Elements[i] = o.expr(el)
+		}
+
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			pair.Key = o.expr(pair.Key)
+			pair.Value = o.expr(pair.Value)
+		}
+
+	case *ast.IndexExpression:
+		e.Left = o.expr(e.Left)
+		e.Index = o.expr(e.Index)
+	}
+
+	return e
+}
+
+// ifExpression optimizes an if expression whose value is used. When the
+// condition is a literal and the branch it takes is a single expression,
+// that expression replaces the if expression.
+func (o *optimizer) ifExpression(ie *ast.IfExpression) ast.Expression {
+	ie.Condition = o.expr(ie.Condition)
+	if !isLiteral(ie.Condition) || declares(dead(ie)) {
+		ie.Consequence = o.block(ie.Consequence)
+		if ie.Alternative != nil {
+			ie.Alternative = o.block(ie.Alternative)
+		}
+		return ie
+	}
+
+	if branch := taken(ie); branch != nil {
+		o.block(branch)
+		if len(branch.Statements) == 1 {
+			if es, ok := branch.Statements[0].(*ast.ExpressionStatement); ok {
+				return es.Expression
+			}
+		}
+	}
+	return trim(ie)
+}
+
+func (o *optimizer) function(fn *ast.FunctionLiteral) {
+	o.scope = newScope(o.scope, fn)
+	defer func() { o.scope = o.scope.outer }()
+
+	for i, def := range fn.Defaults {
+		if def != nil {
+			fn.Defaults[i] = o.expr(def)
+		}
+	}
+	fn.Body.Statements = o.statements(fn.Body.Statements, true)
+}
+
+// fold evaluates node, whose operands are literals, and returns the
+// result as a literal. Operators are evaluated by the evaluator, so that
+// they behave exactly as they do at run time. When that is an error,
+// node is left for the program to raise the error when it runs.
+func (o *optimizer) fold(node ast.Expression) ast.Expression {
+	pos, end := node.Pos(), node.End()
+
+	switch result := evaluator.Eval(node, o.env).(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{
+			Token: token.Token{
+				Type:    token.INT,
+				Literal: strconv.FormatInt(result.Value, 10),
+				Pos:     pos,
+				End:     end,
+			},
+			Value: result.Value,
+		}
+	case *object.String:
+		return &ast.StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: result.Value, Pos: pos, End: end},
+			Value: result.Value,
+		}
+	case *object.Boolean:
+		return newBoolean(result.Value, pos, end)
+	}
+	return node
+}
+
+func newBoolean(value bool, pos, end token.Position) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Pos: pos, End: end}
+	if value {
+		tok.Type, tok.Literal = token.TRUE, "true"
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
+
+// copyLiteral returns a copy of lit at the position of tok, so that errors
+// involving an inlined variable are reported where it is used.
+func copyLiteral(lit ast.Expression, tok token.Token) ast.Expression {
+	switch lit := lit.(type) {
+	case *ast.IntegerLiteral:
+		c := *lit
+		c.Token.Pos, c.Token.End = tok.Pos, tok.End
+		return &c
+	case *ast.StringLiteral:
+		c := *lit
+		c.Token.Pos, c.Token.End = tok.Pos, tok.End
+		return &c
+	case *ast.Boolean:
+		c := *lit
+		c.Token.Pos, c.Token.End = tok.Pos, tok.End
+		return &c
+	}
+	return lit
+}
+
+func isLiteral(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// truthy reports whether the literal lit counts as true in a condition.
+func truthy(lit ast.Expression) bool {
+	if b, ok := lit.(*ast.Boolean); ok {
+		return b.Value
+	}
+	return true
+}
+
+// taken returns the branch ie takes for its literal condition, which is
+// nil if the condition is false and there is no else branch.
+func taken(ie *ast.IfExpression) *ast.BlockStatement {
+	if truthy(ie.Condition) {
+		return ie.Consequence
+	}
+	return ie.Alternative
+}
+
+// dead returns the branch ie never takes for its literal condition.
+func dead(ie *ast.IfExpression) *ast.BlockStatement {
+	if truthy(ie.Condition) {
+		return ie.Alternative
+	}
+	return ie.Consequence
+}
+
+// trim empties the branch that ie never takes for its literal condition.
+func trim(ie *ast.IfExpression) *ast.IfExpression {
+	if truthy(ie.Condition) {
+		ie.Alternative = nil
+	} else {
+		ie.Consequence = &ast.BlockStatement{
+			Token:  ie.Consequence.Token,
+			Rbrace: ie.Consequence.Rbrace,
+		}
+	}
+	return ie
+}
+
+// declares reports whether node declares variables in the scope it is
+// in. Code that does is not removed, as the variables are still declared
+// when it does not run, which decides what identifiers refer to.
+func declares(node ast.Node) bool {
+	if block, ok := node.(*ast.BlockStatement); ok && block == nil {
+		return false
+	}
+
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement, *ast.ImportStatement, *ast.ForStatement:
+			found = true
+		case *ast.TryExpression:
+			found = found || n.Catch != nil
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// escapes reports whether block has a break or continue statement that
+// is not inside a loop or function of its own.
+func escapes(block *ast.BlockStatement) bool {
+	found := false
+	ast.Inspect(block, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BreakStatement, *ast.ContinueStatement:
+			found = true
+		case *ast.WhileStatement, *ast.ForStatement, *ast.FunctionLiteral:
+			return false
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,143 @@
+package optimizer
+
+import (
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/evaluator"
+	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/parser"
+	"playground/go-interpreter/src/resolver"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Folding
+		{"1 + 2 * 3", "7"},
+		{"(10 - 4) / 3 % 2 == 0", "true"},
+		{`"a" + "b" + "c"`, `"abc"`},
+		{"!true; !!5; !(1 < 2)", "false; true; false"},
+		{"1 == true; true != false", "false; true"},
+		{"x + 1 * 2", "x + 2"},
+		{"false && f(); true || f()", "false; true"},
+		{"true && x; false || x; 1 < 2 && 3 > 2", "true && x; false || x; true"},
+		// Errors are left for the program to raise.
+		{"1 / 0; 5 % 0", "1 / 0; 5 % 0"},
+		{"9223372036854775807 + 1", "9223372036854775807 + 1"},
+		{`"a" == "a"; "a" - 1; -true`, `"a" == "a"; "a" - 1; -true`},
+		// Dead branches
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (1 > 2) { f() } else { g(); h() }", "g(); h()"},
+		{"if (false) { f() }; 3", "3"},
+		{"let x = if (false) { 1 } else { 2 }", "let x = 2"},
+		{"let x = if (true) { f(); g() }", "let x = if (true) { f(); g() }"},
+		{"if (false) { 1 }", "if (false) {}"},
+		{"if (x) { 1 + 1 } else { 2 }", "if (x) { 2 } else { 2 }"},
+		// Branches that declare variables are kept.
+		{"if (false) { let y = 1 }; y", "if (false) { let y = 1 }; y"},
+		{"while (x) { if (true) { break; f() } }", "while (x) { if (true) { break; f() } }"},
+		// Inlining
+		{"const k = 2; k * 21", "const k = 2; 42"},
+		{"const k = 2; let f = fn(x) { k * x }", "const k = 2; let f = fn(x) { 2 * x }"},
+		{"let n = 1; n + 1", "let n = 1; n + 1"},
+		{"let f = fn() { let n = 1; n + 1 }", "let f = fn() { let n = 1; 2 }"},
+		{"let f = fn() { let n = 1; let g = fn() { n } }", "let f = fn() { let n = 1; let g = fn() { 1 } }"},
+		{"let f = fn() { let n = 1; n = 2; n }", "let f = fn() { let n = 1; n = 2; n }"},
+		{"let f = fn() { let n = 1; let g = fn() { n += 1 }; n }", "let f = fn() { let n = 1; let g = fn() { n += 1 }; n }"},
+		{"let f = fn() { k }; const k = 1; k", "let f = fn() { k }; const k = 1; 1"},
+		{"const k = 1; let f = fn(k) { k }", "const k = 1; let f = fn(k) { k }"},
+		{"const k = 1; let f = fn() { k; let k = 2 }", "const k = 1; let f = fn() { k; let k = 2 }"},
+		{"const k = 1; for (k in []) {} k", "const k = 1; for (k in []) {} k"},
+		{"if (x) { const k = 1; k }", "if (x) { const k = 1; k }"},
+		{"if (true) { const k = 1 }; k", "const k = 1; 1"},
+		// Modules
+		{"export const k = 2; export let f = fn() { k * 3 }", "export const k = 2; export let f = fn() { 6 }"},
+		{`const a = 1; import { a } from "m"; a`, `const a = 1; import { a } from "m"; a`},
+		{`if (false) { import "m" as m }; m`, `if (false) { import "m" as m }; m`},
+	}
+
+	for _, tt := range tests {
+		actual := Optimize(parse(t, tt.input)).String()
+		expected := parse(t, tt.expected).String()
+		if actual != expected {
+			t.Errorf("wrong program for %q.\nwant=%q\ngot =%q", tt.input, expected, actual)
+		}
+	}
+}
+
+func TestOptimizeKeepsPositions(t *testing.T) {
+	program := Optimize(parse(t, "const k = 1;\nk + (2 + 3)"))
+
+	folded, ok := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expression not folded. got=%s", program.Statements[1])
+	}
+	if folded.Value != 6 {
+		t.Errorf("wrong value. want=6, got=%d", folded.Value)
+	}
+	if pos := folded.Pos(); pos.Line != 2 || pos.Column != 1 {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+	if end := folded.End(); end.Line != 2 || end.Column != 11 {
+		t.Errorf("wrong end. got=%s", end)
+	}
+}
+
+// TestOptimizeKeepsResults runs programs with and without optimizing them
+// and compares what they return, including errors.
+func TestOptimizeKeepsResults(t *testing.T) {
+	tests := []string{
+		"-(1 + 2) * 4",
+		"5; if (false) { 1 }",
+		"5; if (true) {}",
+		"let f = fn() { k }; f(); const k = 1",
+		"const s = \"abc\"; s - 1",
+		"const big = 9223372036854775807; big + 1",
+		"let f = fn(n) { if (n == 0) { return 0 }; if (true) { f(n - 1) } }; f(1000)",
+		"let f = fn() { if (false) { const k = 1 }; k }; f()",
+		"let f = fn() { const k = 1; for (k in [7]) {} k }; f()",
+		"let r = []; for (i in [1, 2]) { if (true) { push(r, i); break; push(r, 0) } } r",
+		`try { const z = 1; z / 0 } catch (e) { e["message"] }`,
+		"let a = [1, 2, 3]; const i = 1; a[i] = 9; a",
+	}
+
+	for _, input := range tests {
+		expected := eval(t, parse(t, input))
+		optimized := parse(t, input)
+		if err := resolver.Resolve(optimized, object.NewEnvironment()); err != nil {
+			t.Fatalf("resolver error for %q: %s", input, err)
+		}
+		actual := eval(t, Optimize(optimized))
+
+		if actual != expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", input, expected, actual)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors()[0])
+	}
+	return program
+}
+
+func eval(t *testing.T, program *ast.Program) string {
+	t.Helper()
+
+	result := evaluator.Eval(program, object.NewEnvironment())
+	if result == nil {
+		return "<nil>"
+	}
+	if err, ok := result.(*object.Error); ok {
+		return err.Message + " at " + err.Pos.String()
+	}
+	return result.Inspect()
+}
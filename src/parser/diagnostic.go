@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"playground/go-interpreter/src/token"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Diagnostic codes reported by the parser. Codes are stable and can be
+// matched on by tooling; the messages are meant for humans and may change.
+const (
+	CodeUnexpectedToken = "P001"
+	CodeNoPrefixParseFn = "P002"
+	CodeInvalidInteger  = "P003"
+	CodeInvalidFloat    = "P004"
+	CodeOutsideLoop     = "P005"
+	CodeInvalidAssign   = "P006"
+	CodeInvalidParam    = "P007"
+	CodeExportNested    = "P008"
+)
+
+// Diagnostic is a single problem found in the source, covering the
+// range [Pos, End).
+type Diagnostic struct {
+	Pos      token.Position
+	End      token.Position
+	Severity Severity
+	Code     string
+	Message  string
+	Hints    []string
+	Expected []token.TokenType
+}
+
+func (d *Diagnostic) Error() string {
+	return d.Message
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Pos, d.Severity, d.Code, d.Message)
+}
+
+// Render formats the diagnostic together with the offending source line,
+// underlining the reported range with carets.
+func (d *Diagnostic) Render(source string) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(d.String())
+	buf.WriteString("\n")
+
+	if line, ok := sourceLine(source, d.Pos.Line); ok && d.Pos.Column > 0 {
+		// Columns count bytes, while the carets line up with the
+		// characters of the line.
+		start := clampColumn(line, d.Pos.Column)
+		width := 1
+		if d.End.Line == d.Pos.Line && d.End.Column > d.Pos.Column {
+			end := clampColumn(line, d.End.Column)
+			width = utf8.RuneCountInString(line[start:end]) + d.End.Column - 1 - end
+		} else if d.End.Line > d.Pos.Line && len(line) >= d.Pos.Column {
+			width = utf8.RuneCountInString(line[start:])
+		}
+
+		indent := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, line[:start])
+
+		buf.WriteString("  " + line + "\n")
+		buf.WriteString("  " + indent + strings.Repeat("^", width) + "\n")
+	}
+
+	for _, hint := range d.Hints {
+		buf.WriteString("  = hint: " + hint + "\n")
+	}
+
+	return buf.String()
+}
+
+// clampColumn returns the byte offset of column in line, at most the
+// length of line.
+func clampColumn(line string, column int) int {
+	if column-1 < len(line) {
+		return column - 1
+	}
+	return len(line)
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if line < 1 {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
@@ -11,6 +11,9 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGNMENT  // = or +=
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         //+
@@ -21,16 +24,28 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGNMENT,
+	token.PLUS_ASSIGN:     ASSIGNMENT,
+	token.MINUS_ASSIGN:    ASSIGNMENT,
+	token.ASTERISK_ASSIGN: ASSIGNMENT,
+	token.SLASH_ASSIGN:    ASSIGNMENT,
+	token.PERCENT_ASSIGN:  ASSIGNMENT,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
 }
 
 type (
@@ -42,7 +57,10 @@ type Parser struct {
 	l              *lexer.Lexer
 	curToken       token.Token
 	peekToken      token.Token
-	errors         []string
+	errors         []*Diagnostic
+	depth          int  // number of open braces up to and including curToken
+	recovering     bool // an error was reported in the current statement
+	loopDepth      int  // number of loops enclosing curToken in the current function
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -50,18 +68,20 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
@@ -74,10 +94,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -87,26 +119,25 @@ func New(l *lexer.Lexer) *Parser {
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []*ast.HashPair{}
 
 	for !p.peekTokenIs(token.RBRACE) {
-		p.nextToken()
-		key := p.parseExpression(LOWEST)
+		key := p.parseNextExpression(LOWEST)
 
 		if !p.expectPeek(token.COLON) {
-			return nil
+			return p.badExpression(hash.Token)
 		}
-		p.nextToken()
-		val := p.parseExpression(LOWEST)
-		hash.Pairs[key] = val
+		val := p.parseNextExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: key, Value: val})
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
-			return nil
+			return p.badExpression(hash.Token)
 		}
 	}
 	if !p.expectPeek(token.RBRACE) {
-		return nil
+		return p.badExpression(hash.Token)
 	}
+	hash.Rbrace = p.curToken
 	return hash
 }
 
@@ -135,8 +166,22 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.addError(p.curToken, CodeInvalidInteger, msg)
+		return p.badExpression(p.curToken)
+	}
+
+	lit.Value = val
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	val, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.addError(p.curToken, CodeInvalidFloat, msg)
+		return p.badExpression(p.curToken)
 	}
 
 	lit.Value = val
@@ -148,10 +193,10 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
-	p.nextToken()
-	exp := p.parseExpression(LOWEST)
+	lparen := p.curToken
+	exp := p.parseNextExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return p.badExpression(lparen)
 	}
 	return exp
 }
@@ -160,40 +205,81 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	exp := &ast.IfExpression{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
-		return nil
+		return p.badExpression(exp.Token)
 	}
-	p.nextToken()
-	exp.Condition = p.parseExpression(LOWEST)
+	exp.Condition = p.parseNextExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return p.badExpression(exp.Token)
 	}
 	if !p.expectPeek(token.LBRACE) {
-		return nil
+		return p.badExpression(exp.Token)
 	}
 	exp.Consequence = p.parseBlockStatement()
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 		if !p.expectPeek(token.LBRACE) {
-			return nil
+			return p.badExpression(exp.Token)
 		}
 		exp.Alternative = p.parseBlockStatement()
 	}
 	return exp
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return p.badExpression(exp.Token)
+	}
+	exp.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return p.badExpression(exp.Token)
+		}
+		exp.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return p.badExpression(exp.Token)
+		}
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return p.badExpression(exp.Token)
+		}
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		d := p.addError(p.peekToken, CodeUnexpectedToken, fmt.Sprintf(
+			"expected catch or finally after try block, got %s instead", p.peekToken.Type))
+		d.Expected = []token.TokenType{token.CATCH, token.FINALLY}
+		return p.badExpression(exp.Token)
+	}
+	return exp
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	depth := p.depth
 
 	p.nextToken()
-	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+	for !p.blockClosed(depth) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.blockClosed(depth) {
+			break
+		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken
 	return block
 }
 
@@ -201,44 +287,92 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	fl := &ast.FunctionLiteral{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
-		return nil
+		return p.badExpression(fl.Token)
+	}
+	if !p.parseFunctionParameters(fl) {
+		return p.badExpression(fl.Token)
 	}
-	fl.Parameters = p.parseFunctionParameters()
 	if !p.expectPeek(token.LBRACE) {
-		return nil
+		return p.badExpression(fl.Token)
 	}
+
+	// break and continue cannot reach a loop outside of the function.
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fl.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 	return fl
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	idens := make([]*ast.Identifier, 0)
+// parseFunctionParameters parses the parameter list of fl: plain names,
+// names with a default value and an optional trailing rest parameter.
+// Parameters without a default cannot follow one that has a default.
+func (p *Parser) parseFunctionParameters(fl *ast.FunctionLiteral) bool {
+	fl.Parameters = make([]*ast.Identifier, 0)
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return idens
+		return true
 	}
 
-	p.nextToken()
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	idens = append(idens, ident)
+	hasDefaults := false
+	seen := make(map[string]bool)
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			fl.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			p.checkDuplicateParam(fl.Rest, seen)
+			break
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.checkDuplicateParam(ident, seen)
+
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			def = p.parseNextExpression(LOWEST)
+			hasDefaults = true
+		} else if hasDefaults {
+			p.addError(ident.Token, CodeInvalidParam, fmt.Sprintf(
+				"parameter %s without a default value follows a parameter with one",
+				ident.Value))
+		}
+		fl.Parameters = append(fl.Parameters, ident)
+		fl.Defaults = append(fl.Defaults, def)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		idens = append(idens, ident)
 	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+	if !hasDefaults {
+		fl.Defaults = nil
+	}
+	return p.expectPeek(token.RPAREN)
+}
+
+// checkDuplicateParam reports a parameter named like an earlier one of
+// the same function, whose name it records in seen otherwise.
+func (p *Parser) checkDuplicateParam(ident *ast.Identifier, seen map[string]bool) {
+	if seen[ident.Value] {
+		p.addError(ident.Token, CodeInvalidParam, fmt.Sprintf("duplicate parameter %s", ident.Value))
+		return
 	}
-	return idens
+	seen[ident.Value] = true
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken
 	return exp
 }
 
@@ -250,13 +384,11 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		return args
 	}
 
-	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseNextExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseNextExpression(LOWEST))
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -267,26 +399,104 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	idx := &ast.IndexExpression{Token: p.curToken, Left: left}
-	p.nextToken()
-	idx.Index = p.parseExpression(LOWEST)
+	idx.Index = p.parseNextExpression(LOWEST)
 	if !p.expectPeek(token.RBRACKET) {
-		return nil
+		return p.badExpression(idx.Token)
 	}
+	idx.Rbracket = p.curToken
 	return idx
 }
 
-func (p *Parser) Errors() []string {
+// parseMemberExpression parses left.name, which is short for left["name"].
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	dot := p.curToken
+	if !p.expectPeek(token.IDENT) {
+		return p.badExpression(dot)
+	}
+
+	name := p.curToken
+	name.Type = token.STRING
+	return &ast.IndexExpression{
+		Token:    dot,
+		Left:     left,
+		Index:    &ast.StringLiteral{Token: name, Value: name.Literal},
+		Rbracket: p.curToken,
+	}
+}
+
+func (p *Parser) Errors() []*Diagnostic {
 	return p.errors
 }
 
+// addError records a diagnostic for tok. Only the first error of a
+// statement is kept; the rest are usually a consequence of it and are
+// dropped until the parser has synchronized again.
+func (p *Parser) addError(tok token.Token, code, msg string) *Diagnostic {
+	d := &Diagnostic{
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Severity: SeverityError,
+		Code:     code,
+		Message:  msg,
+	}
+	if !p.recovering {
+		p.errors = append(p.errors, d)
+		p.recovering = true
+	}
+	return d
+}
+
+func (p *Parser) badExpression(from token.Token) ast.Expression {
+	return &ast.BadExpression{Token: from, To: p.curToken.End}
+}
+
+// synchronize skips tokens after a syntax error until the statement that
+// started at the given brace depth can be considered finished: at a ';',
+// at a '}' closing a block opened inside the statement, before the '}'
+// closing the enclosing block, or before the next statement starting with
+// a keyword.
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && p.depth >= depth {
+		if p.depth == depth {
+			if p.curTokenIs(token.SEMICOLON) || p.curTokenIs(token.RBRACE) {
+				return
+			}
+			switch p.peekToken.Type {
+			case token.RBRACE, token.LET, token.CONST, token.RETURN, token.THROW,
+				token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.IMPORT,
+				token.EXPORT, token.EOF:
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// blockClosed reports whether curToken is the '}' that closes a block
+// whose contents are at the given brace depth.
+func (p *Parser) blockClosed(depth int) bool {
+	return p.curTokenIs(token.RBRACE) && p.depth < depth
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.addError(p.peekToken, CodeUnexpectedToken, msg)
+	d.Expected = []token.TokenType{t}
+	if p.peekTokenIs(token.EOF) {
+		d.Hints = append(d.Hints, "the input ended early; is a closing delimiter missing?")
+	}
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		p.depth--
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -311,14 +521,55 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	start, depth := p.curToken, p.depth
+	outerRecovering := p.recovering
+	p.recovering = false
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if let := p.parseLetStatement(); let != nil {
+			stmt = let
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.THROW:
+		stmt = p.parseThrowStatement()
+	case token.WHILE:
+		if while := p.parseWhileStatement(); while != nil {
+			stmt = while
+		}
+	case token.FOR:
+		if forStmt := p.parseForStatement(); forStmt != nil {
+			stmt = forStmt
+		}
+	case token.BREAK:
+		stmt = p.parseBreakStatement()
+	case token.CONTINUE:
+		stmt = p.parseContinueStatement()
+	case token.IMPORT:
+		if imp := p.parseImportStatement(); imp != nil {
+			stmt = imp
+		}
+	case token.EXPORT:
+		if export := p.parseExportStatement(); export != nil {
+			stmt = export
+		}
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	if !p.recovering {
+		p.recovering = outerRecovering
+		return stmt
 	}
+
+	p.synchronize(depth)
+	p.recovering = outerRecovering
+	if stmt == nil {
+		return &ast.BadStatement{Token: start, To: p.curToken.End}
+	}
+	return stmt
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
@@ -333,17 +584,35 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noPrefixParseFnError(tok token.Token) {
+	msg := fmt.Sprintf("no prefix parse function for %s found", tok.Type)
+	d := p.addError(tok, CodeNoPrefixParseFn, msg)
+	if tok.Type == token.EOF {
+		d.Hints = append(d.Hints, "the input ended where an expression was expected")
+	} else {
+		d.Hints = append(d.Hints, fmt.Sprintf("%q cannot start an expression", tok.Literal))
+	}
+}
+
+// parseNextExpression advances to the next token and parses an expression
+// starting there. A closing delimiter in place of the expression is
+// reported but left unconsumed, so the caller can still match it.
+func (p *Parser) parseNextExpression(precedence int) ast.Expression {
+	switch p.peekToken.Type {
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.SEMICOLON, token.EOF:
+		p.noPrefixParseFnError(p.peekToken)
+		return &ast.BadExpression{Token: p.peekToken, To: p.peekToken.Pos}
+	}
+	p.nextToken()
+	return p.parseExpression(precedence)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	//defer untrace(trace("parseExpression"))
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		p.noPrefixParseFnError(p.curToken)
+		return p.badExpression(p.curToken)
 	}
 
 	leftExp := prefix()
@@ -366,8 +635,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 		Operator: p.curToken.Literal,
 	}
 
-	p.nextToken()
-	exp.Right = p.parseExpression(PREFIX)
+	exp.Right = p.parseNextExpression(PREFIX)
 	return exp
 }
 
@@ -380,23 +648,51 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
-	p.nextToken()
-	exp.Right = p.parseExpression(precedence)
+	exp.Right = p.parseNextExpression(precedence)
+	return exp
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", target.String())
+		d := p.addError(p.curToken, CodeInvalidAssign, msg)
+		d.Pos = target.Pos()
+		d.Hints = append(d.Hints, "only variables and index expressions can be assigned to")
+	}
+
+	// Assignments are right-associative: a = b = c is a = (b = c).
+	exp.Value = p.parseNextExpression(ASSIGNMENT - 1)
 	return exp
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	rs := &ast.ReturnStatement{Token: p.curToken}
 
-	p.nextToken()
-
-	rs.ReturnValue = p.parseExpression(LOWEST)
+	rs.ReturnValue = p.parseNextExpression(LOWEST)
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return rs
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	ts := &ast.ThrowStatement{Token: p.curToken}
+
+	ts.Value = p.parseNextExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return ts
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -409,19 +705,185 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
+	stmt.Value = p.parseNextExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseImportStatement parses import "path" as name and
+// import { name, other as alias } from "path".
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Members = []*ast.ImportMember{}
+		for !p.peekTokenIs(token.RBRACE) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			member := &ast.ImportMember{
+				Export: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+			}
+			member.Name = member.Export
+			if p.peekWordIs("as") {
+				p.nextToken()
+				if !p.expectPeek(token.IDENT) {
+					return nil
+				}
+				member.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			}
+			stmt.Members = append(stmt.Members, member)
+
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		if !p.expectWord("from") || !p.expectPeek(token.STRING) {
+			return nil
+		}
+		stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	} else {
+		if !p.expectPeek(token.STRING) {
+			return nil
+		}
+		stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectWord("as") || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseExportStatement parses a let or const statement marked with
+// export, which is only allowed at the top level of a file.
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	if p.depth > 0 {
+		p.addError(p.curToken, CodeExportNested, "export is only allowed at the top level")
+	}
+
+	if !p.peekTokenIs(token.LET) && !p.peekTokenIs(token.CONST) {
+		msg := fmt.Sprintf("expected let or const after export, got %s instead", p.peekToken.Type)
+		d := p.addError(p.peekToken, CodeUnexpectedToken, msg)
+		d.Expected = []token.TokenType{token.LET, token.CONST}
+		return nil
+	}
 	p.nextToken()
 
-	stmt.Value = p.parseExpression(LOWEST)
+	let := p.parseLetStatement()
+	if let == nil {
+		return nil
+	}
+	stmt.Statement = let
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	stmt.Condition = p.parseNextExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	stmt.Iterable = p.parseNextExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+	return body
+}
 
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	p.checkInsideLoop()
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	p.checkInsideLoop()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) checkInsideLoop() {
+	if p.loopDepth == 0 {
+		msg := fmt.Sprintf("%s outside of a loop", p.curToken.Literal)
+		p.addError(p.curToken, CodeOutsideLoop, msg)
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	arr := &ast.ArrayLiteral{Token: p.curToken}
 	arr.Elements = p.parseExpressionList(token.RBRACKET)
+	arr.Rbracket = p.curToken
 	return arr
 }
 
@@ -433,13 +895,11 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return list
 	}
 
-	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseNextExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseNextExpression(LOWEST))
 	}
 
 	if !p.expectPeek(end) {
@@ -448,6 +908,22 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// peekWordIs reports whether the next token is the identifier word, as
+// the words of import statements are not keywords.
+func (p *Parser) peekWordIs(word string) bool {
+	return p.peekTokenIs(token.IDENT) && p.peekToken.Literal == word
+}
+
+func (p *Parser) expectWord(word string) bool {
+	if p.peekWordIs(word) {
+		p.nextToken()
+		return true
+	}
+	msg := fmt.Sprintf("expected next token to be %q, got %s instead", word, p.peekToken.Type)
+	p.addError(p.peekToken, CodeUnexpectedToken, msg)
+	return false
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
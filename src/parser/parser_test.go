@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"playground/go-interpreter/src/ast"
 	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/token"
 	"testing"
 )
 
@@ -64,6 +65,32 @@ func testLetStatement(t *testing.T, stmt ast.Statement, ident string) bool {
 	return true
 }
 
+func TestConstStatement(t *testing.T) {
+	l := lexer.New("const answer = 42;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false")
+	}
+	if stmt.Name.Value != "answer" {
+		t.Errorf("stmt.Name.Value not 'answer'. got=%s", stmt.Name.Value)
+	}
+	testLiteralExpression(t, stmt.Value, 42)
+	if stmt.String() != "const answer = 42;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	input := `
    return 5;
@@ -156,6 +183,38 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.25;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %f. got=%f", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.25",
+			literal.TokenLiteral())
+	}
+}
+
 func TestPrefixExpression(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -215,6 +274,11 @@ func TestInfixExpression(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 	}
@@ -365,6 +429,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a = b = c + 1",
+			"a = b = (c + 1)",
+		},
+		{
+			"a[i + 1] += b * 2",
+			"(a[(i + 1)]) += (b * 2)",
+		},
+		{
+			"x = a || b",
+			"x = (a || b)",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a < b && b != c || !d",
+			"(((a < b) && (b != c)) || (!d))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -510,6 +606,375 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		catchParam string
+		hasCatch   bool
+		hasFinally bool
+		expected   string
+	}{
+		{"try { x } catch (e) { y }", "e", true, false, "try x catch (e) y"},
+		{"try { x } finally { z }", "", false, true, "try x finally z"},
+		{"try { x } catch (err) { y } finally { z }", "err", true, true, "try x catch (err) y finally z"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if (exp.Catch != nil) != tt.hasCatch || (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("wrong clauses for %q. catch=%v, finally=%v", tt.input, exp.Catch, exp.Finally)
+		}
+		if tt.hasCatch && exp.CatchParam.Value != tt.catchParam {
+			t.Errorf("exp.CatchParam wrong. want=%q, got=%q", tt.catchParam, exp.CatchParam.Value)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("exp.String() wrong. want=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	l := lexer.New(`throw "bad"; throw {"message": x}`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	for i, expected := range []string{"throw bad;", "throw {message:x};"} {
+		stmt, ok := program.Statements[i].(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ThrowStatement. got=%T", program.Statements[i])
+		}
+		if stmt.String() != expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", expected, stmt.String())
+		}
+	}
+}
+
+func TestInvalidTryExpression(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"try { x }; y", "expected catch or finally after try block, got ; instead"},
+		{"try { x } catch { y }", "expected next token to be (, got { instead"},
+		{"try { x } catch (1) { y }", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected errors for %q", tt.input)
+			continue
+		}
+		if errors[0].Message != tt.message {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.message, errors[0].Message)
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedTarget   string
+		expectedOperator string
+		expectedValue    string
+	}{
+		{"x = 5;", "x", "=", "5"},
+		{"x += y;", "x", "+=", "y"},
+		{"arr[0] -= 1;", "(arr[0])", "-=", "1"},
+		{`h["k"] *= 2`, "(h[k])", "*=", "2"},
+		{"x /= 2", "x", "/=", "2"},
+		{"x %= 2", "x", "%=", "2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Target.String() != tt.expectedTarget {
+			t.Errorf("exp.Target wrong. expected=%q, got=%q", tt.expectedTarget, exp.Target.String())
+		}
+		if exp.Operator != tt.expectedOperator {
+			t.Errorf("exp.Operator wrong. expected=%q, got=%q", tt.expectedOperator, exp.Operator)
+		}
+		if exp.Value.String() != tt.expectedValue {
+			t.Errorf("exp.Value wrong. expected=%q, got=%q", tt.expectedValue, exp.Value.String())
+		}
+	}
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	l := lexer.New("a + b = 5; f() += 1;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 errors. got=%d", len(errors))
+	}
+	if errors[0].Code != CodeInvalidAssign || errors[0].Message != "cannot assign to (a + b)" {
+		t.Errorf("wrong error. got=%s", errors[0])
+	}
+	if errors[1].Code != CodeInvalidAssign || errors[1].Pos.Column != 12 {
+		t.Errorf("wrong error. got=%s", errors[1])
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { let x = x + 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+	testLetStatement(t, stmt.Body.Statements[0], "x")
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expected      string
+	}{
+		{"for (x in [1, 2]) { x }", "", "x", "for (x in [1, 2]) x"},
+		{"for (k, v in h) { break; }", "k", "v", "for (k, v in h) break;"},
+		{"for (i, c in \"ab\") { continue }", "i", "c", "for (i, c in ab) continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+		if tt.expectedKey == "" && stmt.Key != nil {
+			t.Errorf("stmt.Key is not nil. got=%s", stmt.Key)
+		}
+		if tt.expectedKey != "" && !testIdentifier(t, stmt.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLoopFollowedBySemicolon(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 3) { x += 1 }; x", "while(x < 3) x += 1x"},
+		{"for (v in xs) { v }; 1", "for (v in xs) v1"},
+		{"let f = fn(n) { while (n > 0) { n -= 1 }; n }", "let f = fn(n) while(n > 0) n -= 1n;"},
+		{"let f = fn(xs) { for (k, v in xs) { v }; xs }", "let f = fn(xs) for (k, v in xs) vxs;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"break;", "break outside of a loop"},
+		{"if (true) { continue }", "continue outside of a loop"},
+		{"while (true) { fn() { break } }", "break outside of a loop"},
+		{"while (true) { if (x) { break } }", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expectedError == "" {
+			checkParseErrors(t, p)
+			continue
+		}
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q. got=%d", tt.input, len(errors))
+			continue
+		}
+		if errors[0].Message != tt.expectedError || errors[0].Code != CodeOutsideLoop {
+			t.Errorf("wrong error for %q. got=%s", tt.input, errors[0])
+		}
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedPath    string
+		expectedName    string
+		expectedMembers []string // export:name
+		expected        string
+	}{
+		{`import "lib.mk" as lib;`, "lib.mk", "lib", nil, `import "lib.mk" as lib;`},
+		{`import { a } from "lib.mk"`, "lib.mk", "", []string{"a:a"}, `import { a } from "lib.mk";`},
+		{
+			`import { a, b as c, } from "../util/lib.mk"`,
+			"../util/lib.mk", "", []string{"a:a", "b:c"},
+			`import { a, b as c } from "../util/lib.mk";`,
+		},
+		{`import {} from "lib.mk"`, "lib.mk", "", []string{}, `import {  } from "lib.mk";`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T",
+				program.Statements[0])
+		}
+		if stmt.Path.Value != tt.expectedPath {
+			t.Errorf("wrong path. expected=%q, got=%q", tt.expectedPath, stmt.Path.Value)
+		}
+		if tt.expectedName == "" && stmt.Name != nil {
+			t.Errorf("stmt.Name is not nil. got=%s", stmt.Name)
+		}
+		if tt.expectedName != "" && !testIdentifier(t, stmt.Name, tt.expectedName) {
+			return
+		}
+
+		members := []string{}
+		for _, m := range stmt.Members {
+			members = append(members, m.Export.Value+":"+m.Name.Value)
+		}
+		if tt.expectedMembers != nil && fmt.Sprint(members) != fmt.Sprint(tt.expectedMembers) {
+			t.Errorf("wrong members. expected=%v, got=%v", tt.expectedMembers, members)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let add = fn(a, b) { a + b }; export const answer = 42;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	for i, name := range []string{"add", "answer"} {
+		stmt, ok := program.Statements[i].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not ast.ExportStatement. got=%T",
+				i, program.Statements[i])
+		}
+		if stmt.Statement.Name.Value != name {
+			t.Errorf("wrong exported name. expected=%q, got=%q", name, stmt.Statement.Name.Value)
+		}
+	}
+	if !program.Statements[1].(*ast.ExportStatement).Statement.IsConst() {
+		t.Errorf("exported const is not constant")
+	}
+	if fn := program.Statements[0].(*ast.ExportStatement).Statement.Value.(*ast.FunctionLiteral); fn.Name != "add" {
+		t.Errorf("exported function not named. got=%q", fn.Name)
+	}
+}
+
+func TestInvalidImportAndExport(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+		expected     string
+	}{
+		{`import "lib.mk"`, CodeUnexpectedToken, `expected next token to be "as", got EOF instead`},
+		{`import lib as lib`, CodeUnexpectedToken, "expected next token to be STRING, got IDENT instead"},
+		{`import { a } "lib.mk"`, CodeUnexpectedToken, `expected next token to be "from", got STRING instead`},
+		{`import { a b } from "lib.mk"`, CodeUnexpectedToken, "expected next token to be ,, got IDENT instead"},
+		{`export fn() {}`, CodeUnexpectedToken, "expected let or const after export, got FUNCTION instead"},
+		{`let f = fn() { export let x = 1 }`, CodeExportNested, "export is only allowed at the top level"},
+		{`if (true) { export const x = 1 }`, CodeExportNested, "export is only allowed at the top level"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q. got=%d %v", tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0].Message != tt.expected || errors[0].Code != tt.expectedCode {
+			t.Errorf("wrong error for %q. got=%s", tt.input, errors[0])
+		}
+	}
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 	l := lexer.New(input)
@@ -552,6 +1017,26 @@ func TestFunctionLiteral(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n", function.Name)
+	}
+}
+
 func TestFunctionParams(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -582,6 +1067,99 @@ func TestFunctionParams(t *testing.T) {
 	}
 }
 
+func TestFunctionDefaultAndRestParams(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+		expectedString   string
+	}{
+		{"fn(a, b = 2) {}", []string{"a", "b"}, []string{"", "2"}, "", "fn(a, b = 2) "},
+		{"fn(a = 1, b = a + 1) {}", []string{"a", "b"}, []string{"1", "(a + 1)"}, "", "fn(a = 1, b = (a + 1)) "},
+		{"fn(first, ...rest) {}", []string{"first"}, nil, "rest", "fn(first, ...rest) "},
+		{"fn(...args) {}", []string{}, nil, "args", "fn(...args) "},
+		{"fn(a, b = [], ...c) {}", []string{"a", "b"}, []string{"", "[]"}, "c", "fn(a, b = [], ...c) "},
+	}
+
+	for _, tc := range tests {
+		l := lexer.New(tc.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		fn := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(fn.Parameters) != len(tc.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d",
+				len(tc.expectedParams), len(fn.Parameters))
+		}
+		for i, param := range tc.expectedParams {
+			testLiteralExpression(t, fn.Parameters[i], param)
+		}
+
+		if len(fn.Defaults) != len(tc.expectedDefaults) {
+			t.Fatalf("length defaults wrong. want %d, got=%d",
+				len(tc.expectedDefaults), len(fn.Defaults))
+		}
+		for i, def := range tc.expectedDefaults {
+			got := ""
+			if fn.Defaults[i] != nil {
+				got = fn.Defaults[i].String()
+			}
+			if got != def {
+				t.Errorf("default %d wrong. want %q, got=%q", i, def, got)
+			}
+		}
+
+		rest := ""
+		if fn.Rest != nil {
+			rest = fn.Rest.Value
+		}
+		if rest != tc.expectedRest {
+			t.Errorf("rest parameter wrong. want %q, got=%q", tc.expectedRest, rest)
+		}
+
+		if fn.String() != tc.expectedString {
+			t.Errorf("fn.String() wrong. want %q, got=%q", tc.expectedString, fn.String())
+		}
+	}
+}
+
+func TestInvalidFunctionParams(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    string
+		message string
+	}{
+		{"fn(a = 1, b) {}", CodeInvalidParam,
+			"parameter b without a default value follows a parameter with one"},
+		{"fn(...rest, a) {}", CodeUnexpectedToken,
+			"expected next token to be ), got , instead"},
+		{"fn(1) {}", CodeUnexpectedToken,
+			"expected next token to be IDENT, got INT instead"},
+		{"fn(a, a) { a }(1, 2)", CodeInvalidParam, "duplicate parameter a"},
+		{"fn(a, b = 1, a = 2) {}", CodeInvalidParam, "duplicate parameter a"},
+		{"fn(a, ...a) {}", CodeInvalidParam, "duplicate parameter a"},
+	}
+
+	for _, tc := range tests {
+		l := lexer.New(tc.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected errors for %q", tc.input)
+			continue
+		}
+		if errors[0].Code != tc.code || errors[0].Message != tc.message {
+			t.Errorf("wrong error for %q. got=%s", tc.input, errors[0])
+		}
+	}
+}
+
 func TestCallExpression(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -725,6 +1303,47 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingMemberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"lib.add", "(lib[add])"},
+		{"lib.add(1, 2)", "(lib[add])(1, 2)"},
+		{"a.b.c", "((a[b])[c])"},
+		{"-a.b * c.d", "((-(a[b])) * (c[d]))"},
+		{"h.x = 1", "(h[x]) = 1"},
+		{"x.5", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if tt.expected == "" {
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected error for %q", tt.input)
+			}
+			continue
+		}
+		checkParseErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("lib.add")).ParseProgram()
+	index := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	if lit, ok := index.Index.(*ast.StringLiteral); !ok || lit.Value != "add" {
+		t.Errorf("index is not the string \"add\". got=%T (%s)", index.Index, index.Index)
+	}
+	if end := index.End(); end.Column != 8 {
+		t.Errorf("wrong end of member expression. got=%s", end)
+	}
+}
+
 func TestParsingHashLiteralStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -742,19 +1361,24 @@ func TestParsingHashLiteralStringKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
 	}
 
-	for k, v := range hash.Pairs {
-		literal, ok := k.(*ast.StringLiteral)
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", k)
+			t.Fatalf("key is not ast.StringLiteral. got=%T", pair.Key)
+		}
+		if literal.String() != expected[i].key {
+			t.Errorf("pair %d has wrong key. want=%q, got=%q", i, expected[i].key, literal.String())
 		}
-		expValue := expected[literal.String()]
-		testIntegerLiteral(t, v, expValue)
+		testIntegerLiteral(t, pair.Value, expected[i].value)
 	}
 }
 
@@ -805,17 +1429,225 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for k, v := range hash.Pairs {
-		lit, ok := k.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		lit, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", k)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
 			continue
 		}
 		tstFunc, ok := tests[lit.String()]
 		if !ok {
 			t.Errorf("No test function for key %q found", lit.String())
 		}
-		tstFunc(v)
+		tstFunc(pair.Value)
+	}
+
+	if hash.String() != "{one:(0 + 1), two:(10 - 8), three:(15 / 5)}" {
+		t.Errorf("hash.String() not in source order. got=%q", hash.String())
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b;
+};
+add(-1, [2][0]) + {"k": 3}["k"];`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	sum := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	call := sum.Left.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{let, "let add = fn(a, b) {\n  a + b;\n}"},
+		{fn.Body, "{\n  a + b;\n}"},
+		{fn.Body.Statements[0], "a + b"},
+		{sum, `add(-1, [2][0]) + {"k": 3}["k"]`},
+		{call, "add(-1, [2][0])"},
+		{call.Arguments[0], "-1"},
+		{call.Arguments[1], "[2][0]"},
+		{sum.Right, `{"k": 3}["k"]`},
+	}
+
+	for _, tt := range tests {
+		got := input[tt.node.Pos().Offset:tt.node.End().Offset]
+		if got != tt.expected {
+			t.Errorf("wrong node range. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	if pos := sum.Right.Pos(); pos.Line != 4 || pos.Column != 19 {
+		t.Errorf("wrong position for hash index. got=%s", pos)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedCode     string
+		expectedLine     int
+		expectedColumn   int
+		expectedExpected []token.TokenType
+	}{
+		{"let x 5;", CodeUnexpectedToken, 1, 7, []token.TokenType{token.ASSIGN}},
+		{"let = 5;", CodeUnexpectedToken, 1, 5, []token.TokenType{token.IDENT}},
+		{"1 +\n  ;", CodeNoPrefixParseFn, 2, 3, nil},
+		{"99999999999999999999", CodeInvalidInteger, 1, 1, nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("no diagnostics for %q", tt.input)
+			continue
+		}
+
+		d := errors[0]
+		if d.Code != tt.expectedCode {
+			t.Errorf("wrong code for %q. expected=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+		if d.Severity != SeverityError {
+			t.Errorf("wrong severity for %q. got=%s", tt.input, d.Severity)
+		}
+		if d.Pos.Line != tt.expectedLine || d.Pos.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%s",
+				tt.input, tt.expectedLine, tt.expectedColumn, d.Pos)
+		}
+		if fmt.Sprint(d.Expected) != fmt.Sprint(tt.expectedExpected) {
+			t.Errorf("wrong expected tokens for %q. expected=%v, got=%v",
+				tt.input, tt.expectedExpected, d.Expected)
+		}
+	}
+}
+
+func TestDiagnosticRender(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;\nlet b == 2;", `main.mk:2:7: error[P001]: expected next token to be =, got == instead
+  let b == 2;
+        ^^
+`},
+		{`let s = "héllo"; let = 1`, `main.mk:1:23: error[P001]: expected next token to be IDENT, got = instead
+  let s = "héllo"; let = 1
+                       ^
+`},
+		{`let "héllo" = 1`, `main.mk:1:5: error[P001]: expected next token to be IDENT, got STRING instead
+  let "héllo" = 1
+      ^^^^^^^
+`},
+		{"\tlet ü ==", `main.mk:1:6: error[P001]: expected next token to be IDENT, got ILLEGAL instead
+  	let ü ==
+  	    ^
+`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewWithFilename("main.mk", tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Fatalf("expected diagnostics for %q", tt.input)
+		}
+		if got := p.Errors()[0].Render(tt.input); got != tt.expected {
+			t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", tt.expected, got)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `let x 5;
+let y = 10;
+let add = fn(a, b) {
+  let = a;
+  a + b;
+};
+let z = add(1, 2;
+puts(x + );
+z;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []struct {
+		line int
+		code string
+	}{
+		{1, CodeUnexpectedToken},
+		{4, CodeUnexpectedToken},
+		{7, CodeUnexpectedToken},
+		{8, CodeNoPrefixParseFn},
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		for _, e := range errors {
+			t.Errorf("parser error: %s", e)
+		}
+		t.Fatalf("wrong number of errors. expected=%d, got=%d",
+			len(expectedErrors), len(errors))
+	}
+
+	for i, expected := range expectedErrors {
+		if errors[i].Pos.Line != expected.line || errors[i].Code != expected.code {
+			t.Errorf("errors[%d] wrong. expected line %d %s, got %s",
+				i, expected.line, expected.code, errors[i])
+		}
+	}
+
+	if len(program.Statements) != 6 {
+		t.Fatalf("program.Statements does not contain 6 statements. got=%d",
+			len(program.Statements))
+	}
+
+	if _, ok := program.Statements[0].(*ast.BadStatement); !ok {
+		t.Errorf("program.Statements[0] is not *ast.BadStatement. got=%T",
+			program.Statements[0])
+	}
+	if !testLetStatement(t, program.Statements[1], "y") {
+		return
+	}
+
+	fn := program.Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 2 {
+		t.Fatalf("function body does not contain 2 statements. got=%d",
+			len(fn.Body.Statements))
+	}
+	if _, ok := fn.Body.Statements[0].(*ast.BadStatement); !ok {
+		t.Errorf("fn.Body.Statements[0] is not *ast.BadStatement. got=%T",
+			fn.Body.Statements[0])
+	}
+	if fn.Body.Statements[1].String() != "(a + b)" {
+		t.Errorf("fn.Body.Statements[1] wrong. got=%q", fn.Body.Statements[1].String())
+	}
+
+	call := program.Statements[4].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if _, ok := call.Arguments[0].(*ast.InfixExpression).Right.(*ast.BadExpression); !ok {
+		t.Errorf("argument is not a partial infix expression. got=%s", call.Arguments[0])
+	}
+
+	if !testIdentifier(t, program.Statements[5].(*ast.ExpressionStatement).Expression, "z") {
+		return
 	}
 }
 
@@ -0,0 +1,140 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/monkey"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/token"
+	"sort"
+	"strings"
+	"time"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(s *session, arg string) bool // returns true to end the session
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"env":    {"", "list the bindings of the session", (*session).cmdEnv},
+		"ast":    {"<expr>", "print the syntax tree of expr", (*session).cmdAst},
+		"tokens": {"<expr>", "print the tokens of expr", (*session).cmdTokens},
+		"load":   {"<file.mk>", "evaluate a file in the session", (*session).cmdLoad},
+		"reset":  {"", "discard all bindings", (*session).cmdReset},
+		"time":   {"<expr>", "evaluate expr and report how long it took", (*session).cmdTime},
+		"type":   {"<expr>", "evaluate expr and print the type of its value", (*session).cmdType},
+		"help":   {"", "show this help", (*session).cmdHelp},
+		"quit":   {"", "leave the REPL", (*session).cmdQuit},
+	}
+}
+
+// runCommand executes a line starting with ':' and reports whether the
+// session should end.
+func (s *session) runCommand(line string) bool {
+	name, arg := line[1:], ""
+	if i := strings.IndexAny(name, " \t\n"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i+1:])
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command :%s, try :help\n", name)
+		return false
+	}
+	if cmd.usage != "" && arg == "" {
+		fmt.Fprintf(s.out, "usage: :%s %s\n", name, cmd.usage)
+		return false
+	}
+	return cmd.run(s, arg)
+}
+
+func (s *session) cmdEnv(string) bool {
+	for _, name := range s.interp.Names() {
+		val, _ := s.interp.Lookup(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, val.Inspect())
+	}
+	return false
+}
+
+func (s *session) cmdAst(arg string) bool {
+	if program, ok := s.parse("", arg); ok {
+		ast.Fprint(s.out, program)
+	}
+	return false
+}
+
+func (s *session) cmdTokens(arg string) bool {
+	l := lexer.New(arg)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-6s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+	return false
+}
+
+func (s *session) cmdLoad(arg string) bool {
+	source, err := os.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return false
+	}
+	if evaluated := s.eval(arg, string(source)); evaluated != nil {
+		if _, ok := evaluated.(*object.Error); ok {
+			fmt.Fprintln(s.out, evaluated.Inspect())
+		}
+	}
+	return false
+}
+
+func (s *session) cmdReset(string) bool {
+	s.interp = monkey.New(s.opts)
+	return false
+}
+
+func (s *session) cmdTime(arg string) bool {
+	start := time.Now()
+	evaluated := s.eval("", arg)
+	elapsed := time.Since(start)
+
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect()+"\n")
+	}
+	fmt.Fprintf(s.out, "time: %s\n", elapsed)
+	return false
+}
+
+func (s *session) cmdType(arg string) bool {
+	if evaluated := s.eval("", arg); evaluated != nil {
+		if _, ok := evaluated.(*object.Error); ok {
+			io.WriteString(s.out, evaluated.Inspect()+"\n")
+		} else {
+			io.WriteString(s.out, string(evaluated.Type())+"\n")
+		}
+	}
+	return false
+}
+
+func (s *session) cmdHelp(string) bool {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(s.out, "  %-18s %s\n", ":"+name+" "+cmd.usage, cmd.help)
+	}
+	return false
+}
+
+func (s *session) cmdQuit(string) bool {
+	return true
+}
@@ -0,0 +1,292 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineReader returns a line editor with history when in is a terminal
+// and a plain line scanner otherwise.
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		return &lineEditor{
+			in:      bufio.NewReader(f),
+			fd:      f.Fd(),
+			out:     out,
+			history: loadHistory(historyPath()),
+		}
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (s *scannerReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(s.out, prompt)
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+// lineEditor reads lines from a terminal in raw mode, supporting cursor
+// movement, the usual Emacs-style control keys and history browsing.
+type lineEditor struct {
+	in      *bufio.Reader
+	fd      uintptr
+	out     io.Writer
+	history *history
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	line, err := e.edit(prompt)
+	if err == nil {
+		e.history.add(line)
+	}
+	return line, err
+}
+
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	histIdx := len(e.history.entries)
+	pending := ""
+
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+	}
+
+	e.refresh(prompt, buf, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace, Ctrl-H
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf = buf[pos:]
+			pos = 0
+		case 16, 14: // Ctrl-P, Ctrl-N
+			histIdx, pending = e.browse(r == 16, histIdx, pending, string(buf), setLine)
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case "[A", "OA":
+				histIdx, pending = e.browse(true, histIdx, pending, string(buf), setLine)
+			case "[B", "OB":
+				histIdx, pending = e.browse(false, histIdx, pending, string(buf), setLine)
+			case "[C", "OC":
+				if pos < len(buf) {
+					pos++
+				}
+			case "[D", "OD":
+				if pos > 0 {
+					pos--
+				}
+			case "[H", "OH", "[1~":
+				pos = 0
+			case "[F", "OF", "[4~":
+				pos = len(buf)
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+
+		e.refresh(prompt, buf, pos)
+	}
+}
+
+// browse moves through the history, remembering the line that was being
+// edited before the first step back so it can be restored.
+func (e *lineEditor) browse(
+	back bool,
+	idx int,
+	pending, current string,
+	setLine func(string),
+) (int, string) {
+	entries := e.history.entries
+	if idx == len(entries) {
+		pending = current
+	}
+
+	if back && idx > 0 {
+		idx--
+	} else if !back && idx < len(entries) {
+		idx++
+	} else {
+		return idx, pending
+	}
+
+	if idx == len(entries) {
+		setLine(pending)
+	} else {
+		setLine(entries[idx])
+	}
+	return idx, pending
+}
+
+// readEscape reads the remainder of an ANSI escape sequence and returns it
+// without the leading ESC.
+func (e *lineEditor) readEscape() string {
+	var seq []byte
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return string(seq)
+		}
+		seq = append(seq, b)
+		if len(seq) == 1 {
+			if b != '[' && b != 'O' {
+				return string(seq)
+			}
+			continue
+		}
+		if b >= 0x40 && b <= 0x7e {
+			return string(seq)
+		}
+	}
+}
+
+func (e *lineEditor) refresh(prompt string, buf []rune, pos int) {
+	var sb strings.Builder
+
+	sb.WriteString("\r")
+	sb.WriteString(prompt)
+	sb.WriteString(string(buf))
+	sb.WriteString("\x1b[K")
+	if back := len(buf) - pos; back > 0 {
+		sb.WriteString(fmt.Sprintf("\x1b[%dD", back))
+	}
+
+	io.WriteString(e.out, sb.String())
+}
+
+const maxHistory = 1000
+
+// history keeps the lines entered in previous sessions. Every line is
+// appended to the history file as soon as it is entered.
+type history struct {
+	path    string
+	entries []string
+}
+
+func historyPath() string {
+	if path := os.Getenv("MONKEY_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+	return h
+}
+
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, line+"\n")
+}
@@ -1,44 +1,143 @@
 package repl
 
 import (
-	"bufio"
 	"io"
-	"playground/go-interpreter/src/evaluator"
+	"playground/go-interpreter/src/ast"
 	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/monkey"
 	"playground/go-interpreter/src/object"
 	"playground/go-interpreter/src/parser"
+	"playground/go-interpreter/src/token"
+	"strings"
 )
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+const (
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. "
+)
+
+// Start runs a session reading input from in, whose inputs run one after
+// the other on an interpreter created with opts, made incremental so
+// that functions can call those defined by later inputs. Inputs import
+// modules relative to the working directory, or else from the module
+// path of opts.
+func Start(in io.Reader, out io.Writer, opts monkey.Options) {
+	opts.Incremental = true
+	lines := newLineReader(in, out)
+	s := &session{out: out, opts: opts, interp: monkey.New(opts)}
 
 	for {
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(lines)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+
+		trimmed := strings.TrimSpace(input)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, ":") {
+			if s.runCommand(trimmed) {
+				return
+			}
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
+		if evaluated := s.eval("", input); evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
 
-func printParseErrors(out io.Writer, errs []string) {
+// session holds the state shared by the inputs of one REPL run.
+type session struct {
+	out    io.Writer
+	opts   monkey.Options
+	interp *monkey.Interpreter
+}
+
+// parse parses source, printing the parser errors if there are any.
+func (s *session) parse(filename, source string) (*ast.Program, bool) {
+	l := lexer.NewWithFilename(filename, source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(s.out, source, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+// eval runs source, returning its value or the error it failed with. It
+// prints syntax errors itself and returns nil for them.
+func (s *session) eval(filename, source string) object.Object {
+	evaluated, err := s.interp.Run(filename, source)
+	switch err := err.(type) {
+	case nil:
+		return evaluated
+	case *monkey.SyntaxError:
+		printParseErrors(s.out, source, err.Diagnostics)
+		return nil
+	case *monkey.RuntimeError:
+		return err.Err
+	default:
+		return &object.Error{Message: err.Error()}
+	}
+}
+
+// readInput reads one complete piece of input, asking for continuation
+// lines while brackets are unbalanced or a string is left open.
+func readInput(lines lineReader) (string, error) {
+	line, err := lines.ReadLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
+
+	input := line
+	for isIncomplete(input) {
+		line, err = lines.ReadLine(CONTINUATION_PROMPT)
+		if err == io.EOF {
+			return input, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		input += "\n" + line
+	}
+	return input, nil
+}
+
+// isIncomplete reports whether input ends inside an unterminated string
+// or with more opening than closing brackets.
+func isIncomplete(input string) bool {
+	depth := 0
+	l := lexer.New(input)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		case token.STRING:
+			span := input[tok.Pos.Offset:tok.End.Offset]
+			if len(span) < 2 || !strings.HasSuffix(span, `"`) {
+				return true
+			}
+		}
+	}
+
+	return depth > 0
+}
+
+func printParseErrors(out io.Writer, source string, errs []*parser.Diagnostic) {
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
 	for _, e := range errs {
-		io.WriteString(out, "\t"+e+"\n")
+		io.WriteString(out, e.Render(source))
 	}
 }
@@ -0,0 +1,186 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"playground/go-interpreter/src/monkey"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`let x = 5;`, false},
+		{`let add = fn(a, b) {`, true},
+		{"let add = fn(a, b) {\n a + b", true},
+		{"let add = fn(a, b) {\n a + b\n};", false},
+		{`[1, 2,`, true},
+		{`puts(`, true},
+		{`"hello`, true},
+		{`"`, true},
+		{`"hello"`, false},
+		{`"{"`, false},
+		{`)`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1,
+  2)
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, monkey.Options{})
+
+	expected := ">> .. .. >> .. 3\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":env", ""},
+		{"let a = 1;\nlet b = \"x\";\n:env", "a = 1\nb = x\n"},
+		{"let a = 1;\n:reset\n:env", ""},
+		{":type 1 + 1", "INTEGER\n"},
+		{":type \"a\"", "STRING\n"},
+		{":tokens let x", "1:1    LET        \"let\"\n1:5    IDENT      \"x\"\n"},
+		{":ast -a", "Program [1:1-1:3]\n" +
+			"  Statements[0]: ExpressionStatement [1:1-1:3]\n" +
+			"    Expression: PrefixExpression Operator=\"-\" [1:1-1:3]\n" +
+			"      Right: Identifier Value=\"a\" [1:2-1:3]\n"},
+		{":bogus", "unknown command :bogus, try :help\n"},
+		{":type", "usage: :type <expr>\n"},
+		{":quit\n1", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out, monkey.Options{})
+
+		got := strings.Replace(out.String(), PROMPT, "", -1)
+		if got != tt.expected {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     monkey.Options
+		expected string
+	}{
+		{"let a = 1;\nlet a = 2;\na", monkey.Options{}, "2\n"},
+		{"let a = 1;\nlet a = 2;", monkey.Options{Strict: true}, "already declared: a"},
+		{"9223372036854775807 + 1", monkey.Options{}, "-9223372036854775808\n"},
+		{"9223372036854775807 + 1", monkey.Options{CheckedArithmetic: true}, "integer overflow"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };\nf(20)",
+			monkey.Options{MaxCallDepth: 10}, "limit 10"},
+		{"let a = 1;\nlet f = fn() { a + 1 };\nf()", monkey.Options{Engine: monkey.VM}, "2\n"},
+		{"let a = 1;\n:reset\na", monkey.Options{Engine: monkey.VM}, "identifier not found: a"},
+		{"let a = 1;\n:env", monkey.Options{Engine: monkey.VM}, "a = 1\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out, tt.opts)
+
+		got := strings.Replace(out.String(), PROMPT, "", -1)
+		if !strings.Contains(got, tt.expected) {
+			t.Errorf("wrong output for %q with %+v. want %q in %q", tt.input, tt.opts, tt.expected, got)
+		}
+	}
+}
+
+func TestStartForwardReferences(t *testing.T) {
+	input := `let f = fn() { g() };
+f()
+let g = fn() { 2 };
+f()
+`
+	expected := "Traceback (most recent call last):\n" +
+		"  1:1, in <main>\n" +
+		"  1:16, in f\n" +
+		"Error: identifier not found: g\n" +
+		"2\n"
+	for _, engine := range []monkey.Engine{monkey.Evaluator, monkey.VM} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, monkey.Options{Engine: engine})
+
+		got := strings.Replace(out.String(), PROMPT, "", -1)
+		if got != expected {
+			t.Errorf("wrong output with engine %d. want=%q, got=%q", engine, expected, got)
+		}
+	}
+}
+
+func TestStartImports(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "work", "local.mk"), "export let x = 41;")
+	writeFile(t, filepath.Join(dir, "work", "script.mk"), `import "./local.mk" as local; let y = local.x + 1;`)
+	writeFile(t, filepath.Join(dir, "lib", "shared.mk"), "export let z = 3;")
+	chdir(t, filepath.Join(dir, "work"))
+
+	input := `import "./local.mk" as local
+local.x
+import "shared.mk" as shared
+shared.z
+:load script.mk
+y
+import "missing.mk" as missing
+`
+	expected := "41\n3\n42\n1:1: Error: module not found: missing.mk\n"
+	opts := monkey.Options{ModulePath: []string{filepath.Join(dir, "lib")}}
+	for _, engine := range []monkey.Engine{monkey.Evaluator, monkey.VM} {
+		opts.Engine = engine
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, opts)
+
+		got := strings.Replace(out.String(), PROMPT, "", -1)
+		if got != expected {
+			t.Errorf("wrong output with engine %d. want=%q, got=%q", engine, expected, got)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chdir changes the working directory until the end of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
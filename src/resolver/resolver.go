@@ -0,0 +1,299 @@
+// Package resolver binds the identifiers of a program to the variables
+// they refer to before the program runs, so that the evaluator finds a
+// variable by its slot instead of by name and undeclared identifiers are
+// reported without running any code.
+package resolver
+
+import (
+	"fmt"
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/token"
+)
+
+// Error is an identifier that does not refer to any variable or builtin.
+type Error struct {
+	Message string
+	Pos     token.Position
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// scope holds the variables declared in the program or in a function.
+// Variables are declared as the resolver reaches their declaration, so
+// code refers to the variables declared before it, and those of outer
+// scopes.
+type scope struct {
+	outer *scope
+	// env holds the variables of the global scope, names those of a
+	// function.
+	env   *object.Environment
+	names map[string]int
+}
+
+func (s *scope) declare(name string) int {
+	if s.env != nil {
+		return s.env.Declare(name)
+	}
+	slot, ok := s.names[name]
+	if !ok {
+		slot = len(s.names)
+		s.names[name] = slot
+	}
+	return slot
+}
+
+func (s *scope) lookup(name string) (int, bool) {
+	if s.env != nil {
+		return s.env.Slot(name)
+	}
+	slot, ok := s.names[name]
+	return slot, ok
+}
+
+// forward is an identifier in a function that refers to no variable
+// declared before it. It can only refer to a global declared later, as
+// functions calling each other do.
+type forward struct {
+	ident  *ast.Identifier
+	depth  int // of the global scope from the scope of ident
+	format string
+}
+
+type resolver struct {
+	scope    *scope
+	forwards []forward
+}
+
+// Resolve binds the identifiers of program, whose global variables live
+// in env. Globals declared by the program are given a slot in env, as
+// are those its functions use without declaring them if env is
+// incremental.
+func Resolve(program *ast.Program, env *object.Environment) error {
+	r := &resolver{scope: &scope{env: env}}
+
+	for _, s := range program.Statements {
+		if err := r.resolve(s); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.forwards {
+		slot, ok := env.Slot(f.ident.Value)
+		if !ok && env.Incremental() {
+			slot, ok = env.Declare(f.ident.Value), true
+		}
+		if !ok {
+			return &Error{Message: fmt.Sprintf(f.format, f.ident.Value), Pos: f.ident.Pos()}
+		}
+		f.ident.Binding = ast.Binding{Kind: ast.Variable, Depth: f.depth, Slot: slot}
+	}
+
+	return nil
+}
+
+func (r *resolver) resolve(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := r.resolve(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		return r.resolve(node.Expression)
+
+	case *ast.LetStatement:
+		// A function can refer to itself by the name it is bound to.
+		// Other values still see an outer variable of the same name.
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			r.declare(node.Name)
+			return r.resolve(node.Value)
+		}
+		if err := r.resolve(node.Value); err != nil {
+			return err
+		}
+		r.declare(node.Name)
+
+	case *ast.ExportStatement:
+		return r.resolve(node.Statement)
+
+	case *ast.ImportStatement:
+		if node.Name != nil {
+			r.declare(node.Name)
+		}
+		for _, m := range node.Members {
+			r.declare(m.Name)
+		}
+
+	case *ast.ReturnStatement:
+		return r.resolve(node.ReturnValue)
+
+	case *ast.ThrowStatement:
+		return r.resolve(node.Value)
+
+	case *ast.WhileStatement:
+		if err := r.resolve(node.Condition); err != nil {
+			return err
+		}
+		return r.resolve(node.Body)
+
+	case *ast.ForStatement:
+		if err := r.resolve(node.Iterable); err != nil {
+			return err
+		}
+		if node.Key != nil {
+			r.declare(node.Key)
+		}
+		r.declare(node.Value)
+		return r.resolve(node.Body)
+
+	case *ast.PrefixExpression:
+		return r.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		if err := r.resolve(node.Left); err != nil {
+			return err
+		}
+		return r.resolve(node.Right)
+
+	case *ast.IfExpression:
+		if err := r.resolve(node.Condition); err != nil {
+			return err
+		}
+		if err := r.resolve(node.Consequence); err != nil {
+			return err
+		}
+		if node.Alternative != nil {
+			return r.resolve(node.Alternative)
+		}
+
+	case *ast.TryExpression:
+		if err := r.resolve(node.Block); err != nil {
+			return err
+		}
+		if node.Catch != nil {
+			r.declare(node.CatchParam)
+			if err := r.resolve(node.Catch); err != nil {
+				return err
+			}
+		}
+		if node.Finally != nil {
+			return r.resolve(node.Finally)
+		}
+
+	case *ast.AssignExpression:
+		if err := r.resolve(node.Value); err != nil {
+			return err
+		}
+		switch target := node.Target.(type) {
+		case *ast.Identifier:
+			if node.Operator == "=" {
+				return r.bind(target, "assignment to undeclared identifier: %s")
+			}
+			return r.bind(target, "identifier not found: %s")
+		default:
+			return r.resolve(target)
+		}
+
+	case *ast.Identifier:
+		return r.bind(node, "identifier not found: %s")
+
+	case *ast.FunctionLiteral:
+		return r.resolveFunction(node)
+
+	case *ast.CallExpression:
+		if err := r.resolve(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := r.resolve(arg); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := r.resolve(el); err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := r.resolve(pair.Key); err != nil {
+				return err
+			}
+			if err := r.resolve(pair.Value); err != nil {
+				return err
+			}
+		}
+
+	case *ast.IndexExpression:
+		if err := r.resolve(node.Left); err != nil {
+			return err
+		}
+		return r.resolve(node.Index)
+	}
+
+	return nil
+}
+
+// resolveFunction resolves the parameters and the body of a function in
+// a new scope. A default value is resolved after the parameters before
+// it, which it can refer to.
+func (r *resolver) resolveFunction(lit *ast.FunctionLiteral) error {
+	outer := r.scope
+	r.scope = &scope{outer: outer, names: make(map[string]int)}
+	defer func() { r.scope = outer }()
+
+	for i, param := range lit.Parameters {
+		if i < len(lit.Defaults) && lit.Defaults[i] != nil {
+			if err := r.resolve(lit.Defaults[i]); err != nil {
+				return err
+			}
+		}
+		r.declare(param)
+	}
+	if lit.Rest != nil {
+		r.declare(lit.Rest)
+	}
+
+	return r.resolve(lit.Body)
+}
+
+// declare declares the variable named by ident in the current scope.
+func (r *resolver) declare(ident *ast.Identifier) {
+	ident.Binding = ast.Binding{Kind: ast.Variable, Slot: r.scope.declare(ident.Value)}
+}
+
+// bind binds ident to the innermost variable of its name declared so
+// far, or else to the builtin of its name. Without either, an identifier
+// in a function is left for a global declared later, and any other one
+// is an error made of format and the name.
+func (r *resolver) bind(ident *ast.Identifier, format string) error {
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if slot, ok := s.lookup(ident.Value); ok {
+			ident.Binding = ast.Binding{Kind: ast.Variable, Depth: depth, Slot: slot}
+			return nil
+		}
+		depth++
+	}
+
+	for i, def := range object.Builtins {
+		if def.Name == ident.Value {
+			ident.Binding = ast.Binding{Kind: ast.Builtin, Slot: i}
+			return nil
+		}
+	}
+
+	if r.scope.outer != nil {
+		r.forwards = append(r.forwards, forward{ident: ident, depth: depth - 1, format: format})
+		return nil
+	}
+	return &Error{Message: fmt.Sprintf(format, ident.Value), Pos: ident.Pos()}
+}
@@ -0,0 +1,296 @@
+package resolver
+
+import (
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/parser"
+	"testing"
+)
+
+func TestBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []ast.Binding // of the identifiers in the order they appear
+	}{
+		{
+			"let a = 1; let b = a; b",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 1},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 1},
+			},
+		},
+		{
+			"let a = 1; let a = a + 1",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+			},
+		},
+		{
+			"let g = 1; fn(x, y = x) { let z = g; fn() { z + y } }",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 1},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 2},
+				{Kind: ast.Variable, Slot: 0, Depth: 1},
+				{Kind: ast.Variable, Slot: 2, Depth: 1},
+				{Kind: ast.Variable, Slot: 1, Depth: 1},
+			},
+		},
+		{
+			"fn(...rest) { len(rest) }",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Builtin, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+			},
+		},
+		{
+			"let len = 1; len",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+			},
+		},
+		{
+			// A function sees the variables declared after it.
+			"let f = fn() { later }; let later = 1",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 1, Depth: 1},
+				{Kind: ast.Variable, Slot: 1},
+			},
+		},
+		{
+			// Code before a declaration still refers to the outer variable.
+			"let x = 1; fn() { let y = x; let x = 2 }",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0, Depth: 1},
+				{Kind: ast.Variable, Slot: 1},
+			},
+		},
+		{
+			// So does a closure defined before it.
+			"let x = 1; fn() { let g = fn() { x }; let x = 2 }",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 0, Depth: 2},
+				{Kind: ast.Variable, Slot: 1},
+			},
+		},
+		{
+			`import "m" as m; import { a, b as c } from "m"; fn() { m; c }`,
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 1},
+				{Kind: ast.Variable, Slot: 2},
+				{Kind: ast.Variable, Slot: 0, Depth: 1},
+				{Kind: ast.Variable, Slot: 2, Depth: 1},
+			},
+		},
+		{
+			"for (k, v in []) { try { k } catch (e) { e } }",
+			[]ast.Binding{
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 1},
+				{Kind: ast.Variable, Slot: 0},
+				{Kind: ast.Variable, Slot: 2},
+				{Kind: ast.Variable, Slot: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if err := Resolve(program, object.NewEnvironment()); err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err)
+			continue
+		}
+
+		idents := identifiers(program)
+		if len(idents) != len(tt.expected) {
+			t.Errorf("wrong number of identifiers in %q. want=%d, got=%d",
+				tt.input, len(tt.expected), len(idents))
+			continue
+		}
+		for i, ident := range idents {
+			if ident.Binding != tt.expected[i] {
+				t.Errorf("identifier %d (%s) of %q wrongly bound. want=%+v, got=%+v",
+					i, ident.Value, tt.input, tt.expected[i], ident.Binding)
+			}
+		}
+	}
+}
+
+func TestUndeclaredIdentifiers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "1:1: identifier not found: foobar"},
+		{"let a = 1;\na + b", "2:5: identifier not found: b"},
+		{"x; let x = 1", "1:1: identifier not found: x"},
+		{"let f = fn() { g() }", "1:16: identifier not found: g"},
+		{"let f = fn(a, b = c) { a }", "1:19: identifier not found: c"},
+		{"let f = fn() { let y = 1 }; y", "1:29: identifier not found: y"},
+		{"let f = fn() { let g = fn() { y }; let y = 1; g() }", "1:31: identifier not found: y"},
+		{"let f = fn() { y = 1 }", "1:16: assignment to undeclared identifier: y"},
+		{"x = 5", "1:1: assignment to undeclared identifier: x"},
+		{"x += 5", "1:1: identifier not found: x"},
+		{"try { 1 } catch (e) { 2 }; e", ""},
+		{`export let f = fn() { g }`, "1:23: identifier not found: g"},
+		{`lib; import "lib.mk" as lib`, "1:1: identifier not found: lib"},
+	}
+
+	for _, tt := range tests {
+		err := Resolve(parse(t, tt.input), object.NewEnvironment())
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if _, ok := err.(*Error); !ok {
+			t.Errorf("error for %q is not *Error. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestResolveWithGlobals(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("host", &object.Integer{Value: 1})
+
+	program := parse(t, "let mine = host; mine")
+	if err := Resolve(program, env); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	slot, ok := env.Slot("mine")
+	if !ok || slot != 1 {
+		t.Errorf("global not declared in environment. got=%d, %t", slot, ok)
+	}
+	if names := env.Names(); len(names) != 1 || names[0] != "host" {
+		t.Errorf("declaring a global set it. names=%v", names)
+	}
+
+	// Later programs see the globals of earlier ones.
+	if err := Resolve(parse(t, "mine + host"), env); err != nil {
+		t.Errorf("globals not kept between programs: %s", err)
+	}
+}
+
+func TestResolveIncremental(t *testing.T) {
+	env := object.NewEnvironment()
+	if err := Resolve(parse(t, "let f = fn() { g() }"), env); err == nil {
+		t.Fatalf("forward reference to an undeclared global resolved")
+	}
+
+	env = object.NewEnvironment()
+	env.SetIncremental(true)
+	if err := Resolve(parse(t, "let f = fn() { g() }"), env); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := env.Slot("g"); !ok {
+		t.Errorf("forward reference not declared in environment")
+	}
+	if names := env.Names(); len(names) != 0 {
+		t.Errorf("declaring a global set it. names=%v", names)
+	}
+
+	// Identifiers outside functions must still be declared.
+	if err := Resolve(parse(t, "h"), env); err == nil {
+		t.Errorf("undeclared identifier resolved")
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors()[0])
+	}
+	return program
+}
+
+// identifiers returns the identifiers of node in source order.
+func identifiers(node ast.Node) []*ast.Identifier {
+	var idents []*ast.Identifier
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.Program:
+			for _, s := range node.Statements {
+				walk(s)
+			}
+		case *ast.BlockStatement:
+			for _, s := range node.Statements {
+				walk(s)
+			}
+		case *ast.ExpressionStatement:
+			walk(node.Expression)
+		case *ast.LetStatement:
+			walk(node.Name)
+			walk(node.Value)
+		case *ast.ImportStatement:
+			if node.Name != nil {
+				walk(node.Name)
+			}
+			for _, m := range node.Members {
+				walk(m.Name)
+			}
+		case *ast.ForStatement:
+			if node.Key != nil {
+				walk(node.Key)
+			}
+			walk(node.Value)
+			walk(node.Iterable)
+			walk(node.Body)
+		case *ast.TryExpression:
+			walk(node.Block)
+			if node.Catch != nil {
+				walk(node.CatchParam)
+				walk(node.Catch)
+			}
+		case *ast.InfixExpression:
+			walk(node.Left)
+			walk(node.Right)
+		case *ast.FunctionLiteral:
+			for i, param := range node.Parameters {
+				walk(param)
+				if i < len(node.Defaults) && node.Defaults[i] != nil {
+					walk(node.Defaults[i])
+				}
+			}
+			if node.Rest != nil {
+				walk(node.Rest)
+			}
+			walk(node.Body)
+		case *ast.CallExpression:
+			walk(node.Function)
+			for _, arg := range node.Arguments {
+				walk(arg)
+			}
+		case *ast.Identifier:
+			idents = append(idents, node)
+		}
+	}
+	walk(node)
+	return idents
+}
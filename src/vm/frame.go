@@ -0,0 +1,30 @@
+package vm
+
+import (
+	"playground/go-interpreter/src/code"
+	"playground/go-interpreter/src/object"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// callFn and callIP locate the call that created the frame, and
+	// tailCalls counts the tail calls that replaced its function since.
+	callFn    *object.CompiledFunction
+	callIP    int
+	tailCalls int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,1067 @@
+// Package vm executes the bytecode produced by package compiler.
+package vm
+
+import (
+	"fmt"
+	"math"
+	"playground/go-interpreter/src/code"
+	"playground/go-interpreter/src/compiler"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/token"
+)
+
+// StackSize is the initial size of the stack, which grows as needed.
+const StackSize = 2048
+const GlobalsSize = 65536
+
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+type VM struct {
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	frames []*Frame
+	// handlers are the try blocks being executed, innermost last.
+	handlers []handler
+
+	result object.Object
+
+	checked  bool
+	maxDepth int
+	importer object.Importer
+}
+
+// handler records where execution resumes when an error is raised inside
+// a try block.
+type handler struct {
+	frames int // number of frames when the try block was entered
+	sp     int
+	target int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+	}
+	program := &object.Program{
+		Constants:   bytecode.Constants,
+		Globals:     make([]object.Object, GlobalsSize),
+		GlobalNames: bytecode.Globals,
+	}
+	mainClosure := &object.Closure{Fn: mainFn, Program: program}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	return &VM{
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		frames: []*Frame{mainFrame},
+
+		maxDepth: object.DefaultMaxCallDepth,
+	}
+}
+
+// NewWithGlobalsStore creates a VM using the globals of an earlier one,
+// as the REPL does for every line.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.frames[0].cl.Program.Globals = s
+	return vm
+}
+
+// SetCheckedArithmetic makes integer overflow an error instead of
+// wrapping around.
+func (vm *VM) SetCheckedArithmetic(checked bool) {
+	vm.checked = checked
+}
+
+// SetMaxCallDepth sets the number of nested function calls allowed.
+func (vm *VM) SetMaxCallDepth(depth int) {
+	vm.maxDepth = depth
+}
+
+// SetImporter sets the importer that loads the modules the program
+// imports.
+func (vm *VM) SetImporter(importer object.Importer) {
+	vm.importer = importer
+}
+
+// Result returns the value of the program after Run, which is nil when
+// the program ends with a let statement.
+func (vm *VM) Result() object.Object {
+	return vm.result
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames = append(vm.frames, f)
+}
+
+// popFrame removes the current frame along with its try blocks.
+func (vm *VM) popFrame() *Frame {
+	f := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frames > len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+	return f
+}
+
+// Run executes the program. A runtime error that the program does not
+// catch is returned as an *object.Error.
+func (vm *VM) Run() (err error) {
+	// A panic is a bug in the virtual machine; report it like the
+	// evaluator does instead of crashing the host.
+	defer func() {
+		if r := recover(); r != nil {
+			err = &object.Error{
+				Message:  fmt.Sprintf("internal error: %v", r),
+				Pos:      vm.currentPos(),
+				Stack:    vm.callStack(),
+				Internal: true,
+			}
+		}
+	}()
+
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		var rerr *object.Error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.push(frame.cl.Program.Constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpDup2:
+			left, right := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+			vm.push(left)
+			vm.push(right)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan,
+			code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
+			rerr = vm.executeBinaryOperation(op)
+
+		case code.OpTrue:
+			vm.push(True)
+
+		case code.OpFalse:
+			vm.push(False)
+
+		case code.OpNull:
+			vm.push(Null)
+
+		case code.OpBang:
+			vm.executeBangOperator()
+
+		case code.OpMinus:
+			rerr = vm.executeMinusOperator()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+			if !object.IsTruthy(condition) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpIfSet:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+
+			if vm.stack[frame.basePointer+int(localIndex)] != nil {
+				frame.ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			frame.cl.Program.Globals[globalIndex] = vm.pop()
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			globals := frame.cl.Program.Globals
+			if globals[globalIndex] == nil {
+				rerr = object.NewError("assignment to undeclared identifier: %s",
+					vm.globalName(int(globalIndex)))
+				break
+			}
+			globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			val := frame.cl.Program.Globals[globalIndex]
+			if val == nil {
+				rerr = object.NewError("identifier not found: %s", vm.globalName(int(globalIndex)))
+				break
+			}
+			vm.push(val)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			val := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := val.(*object.Cell); ok {
+				val = cell.Value
+			}
+			vm.push(val)
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			vm.push(object.Builtins[builtinIndex].Builtin)
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			vm.push(frame.cl.Free[freeIndex].Value)
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			frame.cl.Free[freeIndex].Value = vm.pop()
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			// The variable moves into a cell the first time a closure
+			// captures it.
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			vm.push(cell)
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			vm.push(array)
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var hash object.Object
+			hash, rerr = vm.buildHash(vm.sp-numElements, vm.sp)
+			if rerr != nil {
+				break
+			}
+			vm.sp = vm.sp - numElements
+
+			vm.push(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			rerr = vm.executeIndexExpression(left, index)
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			rerr = vm.executeIndexAssignment(left, index, val)
+
+		case code.OpCall, code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			rerr = vm.executeCall(int(numArgs), op == code.OpTailCall)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if len(vm.frames) == 1 {
+				vm.result = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			vm.push(returnValue)
+
+		case code.OpReturn:
+			if len(vm.frames) == 1 {
+				vm.result = nil
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			vm.push(Null)
+
+		case code.OpIter:
+			hasKey := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			var it *iterator
+			it, rerr = newIterator(vm.pop(), hasKey == 1)
+			if rerr != nil {
+				break
+			}
+			vm.push(it)
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			it := vm.stack[vm.sp-1].(*iterator)
+			key, value, ok := it.next()
+			if !ok {
+				frame.ip = pos - 1
+				break
+			}
+			vm.push(key)
+			vm.push(value)
+
+		case code.OpThrow:
+			val := vm.pop()
+			if err, ok := val.(*object.Error); ok {
+				// An error caught by a try block without a catch clause
+				// goes on after the finally block.
+				rerr = err
+				break
+			}
+			rerr = &object.Error{Message: object.ThrownMessage(val), Value: val}
+
+		case code.OpError:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			rerr = object.NewError("%s", frame.cl.Program.Constants[constIndex].(*object.String).Value)
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				frames: len(vm.frames),
+				sp:     vm.sp,
+				target: pos,
+			})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpCaught:
+			err := vm.pop().(*object.Error)
+			vm.push(object.CaughtError(err))
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			path := frame.cl.Program.Constants[constIndex].(*object.String).Value
+			rerr = vm.executeImport(path)
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			return fmt.Errorf("unhandled opcode %v", def)
+		}
+
+		if rerr != nil {
+			if rerr = vm.raise(rerr); rerr != nil {
+				return rerr
+			}
+		}
+	}
+}
+
+// raise hands err to the innermost try block, unwinding the stack to it.
+// Unless err has been raised before, it is located at the current
+// instruction first. raise returns err if no try block is left.
+func (vm *VM) raise(err *object.Error) *object.Error {
+	if err.Stack == nil {
+		err.Pos = vm.currentPos()
+		err.Stack = vm.callStack()
+	}
+
+	if len(vm.handlers) == 0 {
+		return err
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.frames = vm.frames[:h.frames]
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.target - 1
+	vm.push(err)
+
+	return nil
+}
+
+// currentPos returns the source position of the instruction being
+// executed.
+func (vm *VM) currentPos() token.Position {
+	frame := vm.currentFrame()
+	return frame.cl.Fn.Positions.Lookup(frame.ip)
+}
+
+// callStack returns the active calls, innermost first.
+func (vm *VM) callStack() []*object.Frame {
+	stack := make([]*object.Frame, len(vm.frames)-1)
+
+	var caller *object.Frame
+	for i, f := range vm.frames[1:] {
+		frame := &object.Frame{
+			Function:  f.cl.Fn.Name,
+			CallSite:  f.callFn.Positions.Lookup(f.callIP),
+			Caller:    caller,
+			Depth:     i + 1,
+			TailCalls: f.tailCalls,
+		}
+		stack[len(stack)-1-i] = frame
+		caller = frame
+	}
+
+	return stack
+}
+
+// globalName returns the name of a global of the current function.
+func (vm *VM) globalName(index int) string {
+	if names := vm.currentFrame().cl.Program.GlobalNames; index < len(names) {
+		return names[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.growStack(vm.sp + 1)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// growStack makes room for at least size values on the stack.
+func (vm *VM) growStack(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+
+	newSize := 2 * len(vm.stack)
+	if newSize < size {
+		newSize = size
+	}
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func (vm *VM) executeCall(numArgs int, tail bool) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if tail {
+			return vm.tailCallClosure(callee, numArgs)
+		}
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return object.NewError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if err := checkArity(cl.Fn, numArgs); err != nil {
+		return err
+	}
+	if len(vm.frames) > vm.maxDepth {
+		return object.NewError("maximum recursion depth exceeded calling %s (limit %d)",
+			functionName(cl.Fn), vm.maxDepth)
+	}
+
+	caller := vm.currentFrame()
+	basePointer := vm.sp - numArgs
+	vm.bindArguments(cl.Fn, basePointer, numArgs)
+
+	frame := NewFrame(cl, basePointer)
+	frame.callFn, frame.callIP = caller.cl.Fn, caller.ip
+	vm.pushFrame(frame)
+
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// tailCallClosure calls cl in the frame of the current function, which
+// returns whatever cl returns.
+func (vm *VM) tailCallClosure(cl *object.Closure, numArgs int) *object.Error {
+	if err := checkArity(cl.Fn, numArgs); err != nil {
+		return err
+	}
+
+	frame := vm.currentFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.bindArguments(cl.Fn, frame.basePointer, numArgs)
+
+	frame.tailCalls++
+	frame.cl = cl
+	frame.ip = -1
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// bindArguments turns the numArgs arguments from basePointer on into the
+// locals of fn: missing arguments are left unset for the default values
+// to fill in, extra ones go to the rest parameter and the other locals
+// start out unset.
+func (vm *VM) bindArguments(fn *object.CompiledFunction, basePointer, numArgs int) {
+	vm.growStack(basePointer + fn.NumLocals)
+
+	var rest *object.Array
+	if fn.Rest {
+		elements := []object.Object{}
+		if numArgs > fn.NumParameters {
+			elements = append(elements,
+				vm.stack[basePointer+fn.NumParameters:basePointer+numArgs]...)
+		}
+		rest = &object.Array{Elements: elements}
+	}
+
+	first := numArgs
+	if first > fn.NumParameters {
+		first = fn.NumParameters
+	}
+	for i := basePointer + first; i < basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	if rest != nil {
+		vm.stack[basePointer+fn.NumParameters] = rest
+	}
+}
+
+// checkArity returns an error if fn cannot be called with n arguments.
+func checkArity(fn *object.CompiledFunction, n int) *object.Error {
+	max := fn.NumParameters
+	min := max - fn.NumDefaults
+
+	var want string
+	switch {
+	case n >= min && (n <= max || fn.Rest):
+		return nil
+	case fn.Rest:
+		want = fmt.Sprintf("at least %d", min)
+	case min == max:
+		want = fmt.Sprintf("%d", max)
+	default:
+		want = fmt.Sprintf("%d to %d", min, max)
+	}
+	return object.NewError("wrong number of arguments to %s: want=%s, got=%d",
+		functionName(fn), want, n)
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+// callBuiltin calls builtin with the arguments on the stack. A panic in
+// the builtin becomes an internal error the program can catch.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) (err *object.Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &object.Error{
+				Message:  fmt.Sprintf("internal error: %v", r),
+				Internal: true,
+			}
+		}
+	}()
+
+	// The builtin may hold on to its arguments, so they must not stay
+	// on the stack.
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case nil:
+		vm.push(Null)
+	case *object.Error:
+		return result
+	default:
+		vm.push(result)
+	}
+	return nil
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) {
+	program := vm.currentFrame().cl.Program
+	function := program.Constants[constIndex].(*object.CompiledFunction)
+
+	free := make([]*object.Cell, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i].(*object.Cell)
+	}
+	vm.sp = vm.sp - numFree
+
+	vm.push(&object.Closure{Fn: function, Free: free, Program: program})
+}
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if left, ok := left.(*object.Integer); ok {
+		if right, ok := right.(*object.Integer); ok {
+			return vm.executeBinaryIntegerOperation(op, left, right)
+		}
+	}
+
+	switch {
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		vm.push(nativeBoolToBooleanObject(left == right))
+		return nil
+	case op == code.OpNotEqual:
+		vm.push(nativeBoolToBooleanObject(left != right))
+		return nil
+	case left.Type() != right.Type():
+		return object.NewError("type mismatch: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	default:
+		return object.NewError("unknown operator: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	}
+}
+
+// executeBinaryIntegerOperation handles operators on two integers.
+// Integer arithmetic wraps around on overflow unless the VM uses checked
+// arithmetic, in which case overflow is an error.
+func (vm *VM) executeBinaryIntegerOperation(
+	op code.Opcode,
+	left, right *object.Integer,
+) *object.Error {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	switch op {
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
+		if (op == code.OpDiv || op == code.OpMod) && rightValue == 0 {
+			return object.NewError("division by zero: %d %s %d", leftValue, operators[op], rightValue)
+		}
+		result, overflow := object.IntegerArithmetic(operators[op], leftValue, rightValue)
+		if overflow && vm.checked {
+			return object.NewError("integer overflow: %d %s %d", leftValue, operators[op], rightValue)
+		}
+		vm.push(&object.Integer{Value: result})
+	case code.OpEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return object.NewError("unknown integer operator: %d", op)
+	}
+	return nil
+}
+
+// executeBinaryFloatOperation handles operators where at least one
+// operand is a float; integer operands are converted.
+func (vm *VM) executeBinaryFloatOperation(
+	op code.Opcode,
+	left, right object.Object,
+) *object.Error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+	case code.OpEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return object.NewError("unknown operator: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	}
+	return nil
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(
+	op code.Opcode,
+	left, right object.Object,
+) *object.Error {
+	if op != code.OpAdd {
+		return object.NewError("unknown operator: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	vm.push(&object.String{Value: leftValue + rightValue})
+	return nil
+}
+
+func (vm *VM) executeBangOperator() {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		vm.push(False)
+	case False:
+		vm.push(True)
+	case Null:
+		vm.push(True)
+	default:
+		vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() *object.Error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer:
+		if vm.checked && operand.Value == math.MinInt64 {
+			return object.NewError("integer overflow: -(%d)", operand.Value)
+		}
+		vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return object.NewError("unknown operator: -%s", operand.Type())
+	}
+	return nil
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hash := &object.Hash{}
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, object.NewError("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) *object.Error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		vm.executeArrayIndex(left, index)
+		return nil
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return vm.executeModuleIndex(left, index)
+	default:
+		return object.NewError("index operator not supported: %s", left.Type())
+	}
+}
+
+// executeImport pushes the module at path, imported from the file of
+// the current instruction.
+func (vm *VM) executeImport(path string) *object.Error {
+	if vm.importer == nil {
+		return object.NewError("cannot import %q: modules are not available", path)
+	}
+	module, err := vm.importer.Import(path, vm.currentPos().Filename)
+	if err != nil {
+		if err, ok := err.(*object.Error); ok {
+			return err
+		}
+		return object.NewError("%s", err)
+	}
+	vm.push(module)
+	return nil
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		vm.push(Null)
+		return
+	}
+
+	vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) *object.Error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return object.NewError("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hashObject.Get(key)
+	if !ok {
+		vm.push(Null)
+		return nil
+	}
+
+	vm.push(value)
+	return nil
+}
+
+func (vm *VM) executeModuleIndex(module, index object.Object) *object.Error {
+	moduleObject := module.(*object.Module)
+	name := index.(*object.String).Value
+
+	value, ok := moduleObject.Get(name)
+	if !ok {
+		return object.NewError("module %s has no export %s", moduleObject.Path, name)
+	}
+
+	vm.push(value)
+	return nil
+}
+
+func (vm *VM) executeIndexAssignment(left, index, val object.Object) *object.Error {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return object.NewError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return object.NewError("index out of range: %d", idx.Value)
+		}
+		left.SetElement(int(idx.Value), val)
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return object.NewError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, val)
+	default:
+		return object.NewError("index assignment not supported: %s", left.Type())
+	}
+
+	vm.push(val)
+	return nil
+}
+
+// iterator steps through the keys and values a for loop visits. It is
+// only ever on the stack.
+type iterator struct {
+	keys   []object.Object // nil when the keys are the indices
+	values []object.Object
+	pos    int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return "ITERATOR"
+}
+func (it *iterator) Inspect() string {
+	return "iterator"
+}
+
+// newIterator returns an iterator over the elements of an array or a
+// string, or the pairs of a hash. Without a key variable, a loop over a
+// hash visits its keys.
+func newIterator(iterable object.Object, hasKey bool) (*iterator, *object.Error) {
+	it := &iterator{}
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		it.values = append(it.values, iterable.Elements...)
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			it.keys = append(it.keys, pair.Key)
+			it.values = append(it.values, pair.Value)
+		}
+		if !hasKey {
+			it.values = it.keys
+		}
+	case *object.String:
+		for _, r := range iterable.Value {
+			it.values = append(it.values, &object.String{Value: string(r)})
+		}
+	default:
+		return nil, object.NewError("cannot iterate over %s", iterable.Type())
+	}
+
+	return it, nil
+}
+
+func (it *iterator) next() (key, value object.Object, ok bool) {
+	if it.pos >= len(it.values) {
+		return nil, nil, false
+	}
+
+	if it.keys != nil {
+		key = it.keys[it.pos]
+	} else {
+		key = &object.Integer{Value: int64(it.pos)}
+	}
+	value = it.values[it.pos]
+	it.pos++
+
+	return key, value, true
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
@@ -0,0 +1,270 @@
+package vm
+
+import (
+	"fmt"
+	"playground/go-interpreter/src/ast"
+	"playground/go-interpreter/src/compiler"
+	"playground/go-interpreter/src/lexer"
+	"playground/go-interpreter/src/object"
+	"playground/go-interpreter/src/parser"
+	"strings"
+	"testing"
+)
+
+func TestUndeclaredIdentifiersStopProgram(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let ran = true; let f = fn() { missing }; f()"))
+	compileErr, ok := err.(*compiler.Error)
+	if !ok {
+		t.Fatalf("no compiler error returned. got=%T (%v)", err, err)
+	}
+	if compileErr.Message != "identifier not found: missing" {
+		t.Errorf("wrong error message. got=%q", compileErr.Message)
+	}
+	if compileErr.Pos.Line != 1 || compileErr.Pos.Column != 32 {
+		t.Errorf("wrong error position. got=%s", compileErr.Pos)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { y }; 1", "identifier not found: y"},
+		{"false && x", "identifier not found: x"},
+		{"if (false) { x }", "identifier not found: x"},
+		{"let f = fn() { let g = fn() { y }; let y = 1; g() }; f()", "identifier not found: y"},
+		{"let f = fn() { y = 1 }; 1", "assignment to undeclared identifier: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	input := `let countdown = fn(n) { 1 + countdown(n - 1) };
+countdown(0)`
+
+	evaluated := testRun(input, false, func(vm *VM) { vm.SetMaxCallDepth(50) })
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "maximum recursion depth exceeded calling countdown (limit 50)" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if len(errObj.Stack) != 50 {
+		t.Errorf("wrong stack depth. want=50, got=%d", len(errObj.Stack))
+	}
+
+	expectedTrace := `Traceback (most recent call last):
+  2:1, in <main>
+  1:29, in countdown
+  1:29, in countdown
+  1:29, in countdown
+  [previous line repeated 46 more times]
+  1:29, in countdown
+Error: maximum recursion depth exceeded calling countdown (limit 50)`
+
+	if errObj.Inspect() != expectedTrace {
+		t.Errorf("wrong traceback. expected=\n%s\ngot=\n%s", expectedTrace, errObj.Inspect())
+	}
+
+	deep := testEval(`let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(5000)`)
+	testIntegerObject(t, deep, 12502500)
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	globals := make([]object.Object, GlobalsSize)
+	globals[symbolTable.Define("crash").Index] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return args[0].(*object.Array).Elements[5]
+		},
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(parse("let f = fn(xs) { crash(xs) }; f([1])")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+	err := vm.Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", err, err)
+	}
+	if !errObj.Internal {
+		t.Errorf("error not marked as internal")
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: runtime error: index out of range") {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if len(errObj.Stack) != 1 || errObj.Stack[0].Function != "f" {
+		t.Errorf("wrong stack. got=%v", errObj.Stack)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x, y = 1, ...rest) { x + 2; };"
+
+	evaluated := testEval(input)
+	cl, ok := evaluated.(*object.Closure)
+	if !ok {
+		t.Fatalf("object is not Closure. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if cl.Fn.NumParameters != 2 || cl.Fn.NumDefaults != 1 || !cl.Fn.Rest {
+		t.Fatalf("function has wrong parameters. got=%d (%d defaults, rest=%t)",
+			cl.Fn.NumParameters, cl.Fn.NumDefaults, cl.Fn.Rest)
+	}
+
+	if cl.Fn.NumLocals != 3 {
+		t.Fatalf("function has wrong number of locals. got=%d", cl.Fn.NumLocals)
+	}
+}
+
+func TestImports(t *testing.T) {
+	importer := testImporter{
+		"lib.mk": {Path: "lib.mk", Exports: map[string]object.Object{
+			"answer": &object.Integer{Value: 42},
+			"double": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+				return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+			}},
+		}},
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib.mk" as lib; lib.answer`, 42},
+		{`import "lib.mk" as lib; lib["answer"] + lib.double(1)`, 44},
+		{`import { answer, double as twice } from "lib.mk"; twice(answer)`, 84},
+		{`let f = fn() { import { answer } from "lib.mk"; answer }; f()`, 42},
+		{`import "lib.mk" as lib; lib.missing`, "module lib.mk has no export missing"},
+		{`import "lib.mk" as lib; lib[0]`, "index operator not supported: MODULE"},
+		{`import "lib.mk" as lib; lib.answer = 1`, "index assignment not supported: MODULE"},
+		{`import { answer, nope } from "lib.mk"`, "module lib.mk has no export nope"},
+		{`import "other.mk" as other`, "module not found: other.mk"},
+		{`const lib = 1; import "lib.mk" as lib`, "cannot redeclare constant: lib"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testRun(tt.input, false, func(vm *VM) { vm.SetImporter(importer) })
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+
+	evaluated := testEval(`import "lib.mk" as lib`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != `cannot import "lib.mk": modules are not available` {
+		t.Errorf("import without an importer did not fail. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+// TestFunctionsOfOtherPrograms calls a function compiled and created by
+// another program, as the functions a module exports are. It keeps using
+// the constants and globals of its own program.
+func TestFunctionsOfOtherPrograms(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	lib := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := lib.Compile(parse(`let n = 0; let count = fn(by) { n += by; ["count", n] }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	libVM := New(lib.Bytecode())
+	if err := libVM.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	count, _ := symbolTable.Resolve("count")
+	importer := testImporter{"lib.mk": {Path: "lib.mk", Exports: map[string]object.Object{
+		"count": libVM.frames[0].cl.Program.Globals[count.Index],
+	}}}
+
+	input := `let n = 100; import { count } from "lib.mk"; count(2); [count(3), n]`
+	evaluated := testRun(input, false, func(vm *VM) { vm.SetImporter(importer) })
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if arr.Inspect() != "[[count, 5], 100]" {
+		t.Errorf("wrong result. got=%s", arr.Inspect())
+	}
+}
+
+// testImporter serves modules by path.
+type testImporter map[string]*object.Module
+
+func (ti testImporter) Import(path, from string) (*object.Module, error) {
+	if module, ok := ti[path]; ok {
+		return module, nil
+	}
+	return nil, fmt.Errorf("module not found: %s", path)
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// testEval compiles and runs input, returning the value of the program or
+// the error it failed with.
+func testEval(input string) object.Object {
+	return testRun(input, false, nil)
+}
+
+func testRun(input string, strict bool, configure func(vm *VM)) object.Object {
+	comp := compiler.New()
+	comp.SetStrict(strict)
+	if err := comp.Compile(parse(input)); err != nil {
+		compileErr := err.(*compiler.Error)
+		return &object.Error{Message: compileErr.Message, Pos: compileErr.Pos}
+	}
+
+	vm := New(comp.Bytecode())
+	if configure != nil {
+		configure(vm)
+	}
+	if err := vm.Run(); err != nil {
+		return err.(*object.Error)
+	}
+	return vm.Result()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}